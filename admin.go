@@ -0,0 +1,175 @@
+package main
+
+/* Admin endpoints, for the notifications that could not be delivered inspite of retries.
+Dead letters can be listed, inspected, replayed or discarded.
+State of the telegram rate limits can be seen too, and device registry cache can be invalidated.
+Health reports the state of the circuit breakers, and schema versions in use by the devices.
+Last known pins of the devices are here in full, since the gpio status messages show only the changes */
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/eensymachines-in/errx/httperr"
+	"github.com/eensymachines-in/webpi-telegnotify/breaker"
+	"github.com/eensymachines-in/webpi-telegnotify/delivery"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+/* deadLetterErr : error from the dead letter store or the queue mapped onto http errors */
+func deadLetterErr(c *gin.Context, err error, stack string) {
+	le := log.WithFields(log.Fields{
+		"stack": stack,
+		"id":    c.Param("id"),
+	})
+	if errors.Is(err, delivery.ErrJobNotFound) {
+		httperr.HttpErrOrOkDispatch(c, httperr.ErrResourceNotFound(err), le)
+		return
+	}
+	if errors.Is(err, delivery.ErrQueueFull) || errors.Is(err, delivery.ErrQueueClosed) {
+		le.WithField("err", err).Error("failed to queue dead letter")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"err_data": "Server is too busy to accept notifications, try again after some time",
+		})
+		return
+	}
+	httperr.HttpErrOrOkDispatch(c, httperr.ErrDBQuery(err), le)
+}
+
+// HndlDeadLetters : lists all the dead letters, oldest first
+func HndlDeadLetters(c *gin.Context) {
+	dead, err := deadLetters.List()
+	if err != nil {
+		deadLetterErr(c, err, "HndlDeadLetters")
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{
+		"count":       len(dead),
+		"deadletters": dead,
+	})
+}
+
+// HndlDeadLetter : single dead letter with the original payload, last error and attempts
+func HndlDeadLetter(c *gin.Context) {
+	j, err := deadLetters.Get(c.Param("id"))
+	if err != nil {
+		deadLetterErr(c, err, "HndlDeadLetter")
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusOK, j)
+}
+
+// HndlReplayDeadLetter : queues the dead letter for delivery again
+func HndlReplayDeadLetter(c *gin.Context) {
+	if err := queue.ReplayDeadLetter(c.Param("id")); err != nil {
+		deadLetterErr(c, err, "HndlReplayDeadLetter")
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusAccepted, gin.H{
+		"delivery_id": c.Param("id"),
+	})
+}
+
+// HndlReplayDeadLetters : queues all the dead letters for delivery again
+func HndlReplayDeadLetters(c *gin.Context) {
+	count, err := queue.ReplayDeadLetters()
+	if err != nil {
+		deadLetterErr(c, fmt.Errorf("replayed %d dead letters: %w", count, err), "HndlReplayDeadLetters")
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusAccepted, gin.H{
+		"count": count,
+	})
+}
+
+// HndlDiscardDeadLetter : removes the dead letter for good
+func HndlDiscardDeadLetter(c *gin.Context) {
+	if _, err := deadLetters.Get(c.Param("id")); err != nil {
+		deadLetterErr(c, err, "HndlDiscardDeadLetter")
+		return
+	}
+	if err := deadLetters.Delete(c.Param("id")); err != nil {
+		deadLetterErr(c, err, "HndlDiscardDeadLetter")
+		return
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// HndlDiscardDeadLetters : removes all the dead letters for good
+func HndlDiscardDeadLetters(c *gin.Context) {
+	dead, err := deadLetters.List()
+	if err != nil {
+		deadLetterErr(c, err, "HndlDiscardDeadLetters")
+		return
+	}
+	for _, j := range dead {
+		if err := deadLetters.Delete(j.ID); err != nil {
+			deadLetterErr(c, err, "HndlDiscardDeadLetters")
+			return
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{
+		"count": len(dead),
+	})
+}
+
+// HndlRateLimits : state of the global and per chat buckets, negative tokens indicate messages waiting
+func HndlRateLimits(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusOK, limiter.Stats())
+}
+
+// HndlSchemaVersions : schema versions of notifications the devices send, ?outdated=true for only the devices on older versions
+func HndlSchemaVersions(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusOK, schemas.Stats(c.Query("outdated") == "true"))
+}
+
+// HndlPinStates : last known pins of all the devices
+func HndlPinStates(c *gin.Context) {
+	snaps := pinStates.Snapshots()
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{
+		"count":   len(snaps),
+		"devices": snaps,
+	})
+}
+
+// HndlDevicePins : last known pins of the device, 404 when the device hasnt reported a gpio status since the start
+func HndlDevicePins(c *gin.Context) {
+	snap, ok := pinStates.Snapshot(c.Param("devid"))
+	if !ok {
+		httperr.HttpErrOrOkDispatch(c, httperr.ErrResourceNotFound(fmt.Errorf("no gpio status from device %s", c.Param("devid"))), log.WithFields(log.Fields{
+			"stack": "HndlDevicePins",
+			"devid": c.Param("devid"),
+		}))
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusOK, snap)
+}
+
+// HndlHealth : state of the breakers around the upstream dependencies, the service itself is up as long as this responds
+func HndlHealth(c *gin.Context) {
+	status := "ok"
+	brkrs := []breaker.Stats{tgBreaker.Stats(), regBreaker.Stats()}
+	for _, b := range brkrs {
+		if b.State != breaker.CLOSED {
+			status = "degraded"
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{
+		"status":   status,
+		"breakers": brkrs,
+	})
+}
+
+// HndlInvalidateDevice : drops the device from the registry cache, next notification from the device looks up devicereg
+func HndlInvalidateDevice(c *gin.Context) {
+	devices.Invalidate(c.Param("devid"))
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// HndlFlushDeviceCache : drops all the devices from the registry cache
+func HndlFlushDeviceCache(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{
+		"count": devices.Flush(),
+	})
+}
@@ -0,0 +1,162 @@
+package breaker
+
+/* Circuit breaker around the upstream http dependencies - devicereg and the telegram server.
+After repeated failures the breaker opens and calls fail fast instead of waiting on timeouts.
+Once the cooldown is over a single probe is let through (half-open), success of which closes the breaker again. */
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOpen = fmt.Errorf("circuit breaker is open")
+)
+
+var (
+	/*
+		NewBreaker : closed breaker to start with
+		name		: upstream the breaker guards, ex: telegram, devicereg
+		threshold	: consecutive failures after which the breaker opens
+		cooldown	: time for which the breaker stays open before probing */
+	NewBreaker = func(name string, threshold int, cooldown time.Duration) *Breaker {
+		if threshold < 1 {
+			threshold = 1
+		}
+		return &Breaker{
+			name:      name,
+			threshold: threshold,
+			cooldown:  cooldown,
+		}
+	}
+)
+
+type State uint8
+
+const (
+	CLOSED State = iota
+	OPEN
+	HALFOPEN
+)
+
+func (s State) String() string {
+	switch s {
+	case CLOSED:
+		return "closed"
+	case OPEN:
+		return "open"
+	case HALFOPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Stats : state of the breaker as reported on health and metrics
+type Stats struct {
+	Name     string     `json:"name"`
+	State    State      `json:"state"`
+	Failures int        `json:"failures"`            // consecutive failures
+	Trips    int        `json:"trips"`               // number of times the breaker opened
+	Rejected int        `json:"rejected"`            // calls that failed fast
+	OpenedAt *time.Time `json:"opened_at,omitempty"` // when the breaker last opened, nil when closed
+}
+
+type Breaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	trips     int
+	rejected  int
+	openedAt  time.Time
+	probing   bool // a probe is in flight when half-open
+}
+
+/*
+	Allow : nil when the call can go through, ErrOpen when it has to fail fast.
+
+Every call allowed has to be followed by either Success or Failure
+*/
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == OPEN && time.Since(b.openedAt) >= b.cooldown {
+		b.state = HALFOPEN
+		b.probing = false
+	}
+	switch b.state {
+	case OPEN:
+		b.rejected++
+		return fmt.Errorf("%s %w", b.name, ErrOpen)
+	case HALFOPEN:
+		if b.probing {
+			b.rejected++
+			return fmt.Errorf("%s %w", b.name, ErrOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+/* Ready : true when a call could go through, without taking up the probe when half-open */
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case OPEN:
+		return time.Since(b.openedAt) >= b.cooldown
+	case HALFOPEN:
+		return !b.probing
+	}
+	return true
+}
+
+/* Success : upstream responded, breaker closes if it was probing */
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	b.state = CLOSED
+}
+
+/* Failure : upstream failed, breaker opens when the failures are over the threshold or the probe failed */
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == HALFOPEN || (b.state == CLOSED && b.failures >= b.threshold) {
+		b.state = OPEN
+		b.openedAt = time.Now()
+		b.trips++
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == OPEN && time.Since(b.openedAt) >= b.cooldown {
+		return HALFOPEN
+	}
+	return b.state
+}
+
+func (b *Breaker) Stats() Stats {
+	state := b.State()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := Stats{Name: b.name, State: state, Failures: b.failures, Trips: b.trips, Rejected: b.rejected}
+	if state != CLOSED {
+		openedAt := b.openedAt
+		result.OpenedAt = &openedAt
+	}
+	return result
+}
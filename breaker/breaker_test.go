@@ -0,0 +1,39 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker("telegram", 3, 50*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, CLOSED, b.State(), "Breaker was expected closed under the threshold")
+	assert.Nil(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, OPEN, b.State(), "Breaker was expected open at the threshold")
+	assert.ErrorIs(t, b.Allow(), ErrOpen, "Open breaker was expected to fail fast")
+	assert.False(t, b.Ready())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, HALFOPEN, b.State())
+	assert.True(t, b.Ready())
+	assert.Nil(t, b.Allow(), "Probe was expected after the cooldown")
+	assert.ErrorIs(t, b.Allow(), ErrOpen, "Only a single probe was expected when half-open")
+	b.Failure()
+	assert.Equal(t, OPEN, b.State(), "Failed probe was expected to open the breaker again")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, b.Allow())
+	b.Success()
+	assert.Equal(t, CLOSED, b.State(), "Successful probe was expected to close the breaker")
+	stats := b.Stats()
+	assert.Equal(t, 2, stats.Trips)
+	assert.Equal(t, 2, stats.Rejected)
+	assert.Nil(t, stats.OpenedAt)
+}
@@ -0,0 +1,316 @@
+package delivery
+
+/* Digest mode for noisy sites, notifications are collected and sent as a single combined message at an interval.
+Per device in the digest, only the latest of the status notifications (gpiostat, vitals) is kept
+while all the events (cfgchange) are listed.
+Devices get their response once the notification is collected, hence the items are persisted till the digest is queued
+and collected again from the store on start. Times are as received, in the timezone of the device */
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	/*
+		NewDigest : collects notifications for the chats and devices in digest mode
+		interval	: time between 2 digests
+		chats		: chat ids for which all the notifications are digested
+		devices		: device ids for which notifications are digested irrespective of the chat
+		st			: persistence for the items till they are sent, nil to keep them only in memory
+		emit		: called with each of the digest messages for the chat when its time to send, items are kept for the next digest on error */
+	NewDigest = func(interval time.Duration, chats, devices []string, st DigestItems, emit func(chatID, txt string) error) *Digest {
+		set := func(ids []string) map[string]bool {
+			result := map[string]bool{}
+			for _, id := range ids {
+				if id = strings.TrimSpace(id); id != "" {
+					result[id] = true
+				}
+			}
+			return result
+		}
+		return &Digest{
+			interval: interval,
+			chats:    set(chats),
+			devices:  set(devices),
+			store:    st,
+			emit:     emit,
+			pending:  map[string]*chatDigest{},
+			since:    time.Now(),
+			quit:     make(chan struct{}),
+		}
+	}
+)
+
+// DigestItem : single notification as collected in the digest
+type DigestItem struct {
+	ID     string    `json:"id"`      // set when the item is added
+	ChatID string    `json:"chat_id"` // set when the item is added
+	DevID  string    `json:"devid"`   // device that raised the notification
+	Header string    `json:"header"`  // device details as rendered atop the device section
+	Typ    string    `json:"typ"`     // type of the notification
+	Txt    string    `json:"txt"`     // rendered notification, without the device details
+	At     time.Time `json:"at"`      // time at which the notification was received, in the timezone of the device
+	Event  bool      `json:"event"`   // events are all listed, for other notifications only the latest is kept
+}
+
+type deviceDigest struct {
+	header string
+	latest map[string]DigestItem // type of notification : latest notification
+	events []DigestItem
+}
+
+type chatDigest struct {
+	devices map[string]*deviceDigest
+	order   []string // device ids in the order they first notified
+	loc     *time.Location
+}
+
+type Digest struct {
+	mu       sync.Mutex
+	interval time.Duration
+	chats    map[string]bool
+	devices  map[string]bool
+	store    DigestItems
+	emit     func(chatID, txt string) error
+	pending  map[string]*chatDigest // chat id : digest
+	since    time.Time
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+/* Covers : true when notifications from the device to the chat are to be digested */
+func (d *Digest) Covers(chatID, devid string) bool {
+	return d.chats[chatID] || d.devices[devid]
+}
+
+/*
+	Add : collects the notification for the next digest to the chat, persisted first.
+
+Incase it cannot be persisted the error is returned and the notification is not collected
+*/
+func (d *Digest) Add(chatID string, item DigestItem) error {
+	item.ID, item.ChatID = newJobID(), chatID
+	if d.store != nil {
+		if err := d.store.Put(item); err != nil {
+			return fmt.Errorf("failed to persist digest item %s", err)
+		}
+	}
+	d.mu.Lock()
+	replaced, ok := d.collect(item)
+	d.mu.Unlock()
+	if ok && d.store != nil {
+		if err := d.store.Delete(replaced); err != nil {
+			log.WithFields(log.Fields{
+				"id":  replaced,
+				"err": err,
+			}).Warn("failed to remove replaced digest item")
+		}
+	}
+	return nil
+}
+
+/* Restore : collects the items persisted before the restart, for the next digest */
+func (d *Digest) Restore() error {
+	if d.store == nil {
+		return nil
+	}
+	items, err := d.store.List()
+	if err != nil {
+		return fmt.Errorf("failed to read digest items %s", err)
+	}
+	replaced := []string{}
+	d.mu.Lock()
+	for _, item := range items {
+		if id, ok := d.collect(item); ok {
+			replaced = append(replaced, id)
+		}
+	}
+	d.mu.Unlock()
+	if len(items) > 0 {
+		log.WithFields(log.Fields{
+			"count": len(items),
+		}).Info("Digest items restored from store")
+	}
+	return d.store.Delete(replaced...)
+}
+
+/* collect : item added to the pending digest of the chat, id of the item that is no longer needed if any. Call with the lock held */
+func (d *Digest) collect(item DigestItem) (string, bool) {
+	cd, ok := d.pending[item.ChatID]
+	if !ok {
+		cd = &chatDigest{devices: map[string]*deviceDigest{}, loc: item.At.Location()}
+		d.pending[item.ChatID] = cd
+	}
+	dd, ok := cd.devices[item.DevID]
+	if !ok {
+		dd = &deviceDigest{latest: map[string]DigestItem{}}
+		cd.devices[item.DevID] = dd
+		cd.order = append(cd.order, item.DevID)
+	}
+	dd.header = item.Header // device details could have changed
+	if item.Event {
+		dd.events = append(dd.events, item)
+		return "", false
+	}
+	old, replaced := dd.latest[item.Typ]
+	if replaced && old.At.After(item.At) {
+		return item.ID, true // collected again after a failed digest, while a newer one has come in
+	}
+	dd.latest[item.Typ] = item
+	return old.ID, replaced
+}
+
+// digestPart : single message of the digest, with the items in it
+type digestPart struct {
+	txt   string
+	items []DigestItem
+}
+
+/*
+	parts : one section per device, latest of each type of notification sorted by type followed by all the events.
+
+Packed into as few messages as possible each within the limit, device details are repeated atop a message that continues the device.
+Item that is alone over the limit is split as is, and is counted in the last of its messages
+*/
+func (cd *chatDigest) parts(title string, limit int) []digestPart {
+	result := []digestPart{}
+	curr, currDev := digestPart{txt: title}, ""
+	for _, devid := range cd.order {
+		dd := cd.devices[devid]
+		typs := []string{}
+		for typ := range dd.latest {
+			typs = append(typs, typ)
+		}
+		sort.Strings(typs)
+		items := []DigestItem{}
+		for _, typ := range typs {
+			items = append(items, dd.latest[typ])
+		}
+		items = append(items, dd.events...)
+		for _, item := range items {
+			block := fmt.Sprintf("-- %s (%s)\n%s", item.Typ, item.At.Format("15:04"), strings.TrimSpace(item.Txt))
+			piece, sep := block, "\n"
+			if currDev != devid {
+				piece, sep = dd.header+"\n"+block, "\n\n"
+			}
+			if curr.txt != "" && utf8.RuneCountInString(curr.txt)+utf8.RuneCountInString(sep)+utf8.RuneCountInString(piece) > limit {
+				result = append(result, curr)
+				curr, piece = digestPart{}, dd.header+"\n"+block
+			}
+			if utf8.RuneCountInString(piece) > limit {
+				if curr.txt != "" {
+					result = append(result, curr)
+				}
+				chunks := telegram.PackMessages([]string{piece}, limit)
+				for _, chunk := range chunks[:len(chunks)-1] {
+					result = append(result, digestPart{txt: chunk})
+				}
+				curr, currDev = digestPart{txt: chunks[len(chunks)-1], items: []DigestItem{item}}, devid
+				continue
+			}
+			if curr.txt == "" {
+				curr.txt = piece
+			} else {
+				curr.txt = curr.txt + sep + piece
+			}
+			curr.items, currDev = append(curr.items, item), devid
+		}
+	}
+	if curr.txt != "" {
+		result = append(result, curr)
+	}
+	return result
+}
+
+/*
+	Flush : sends the digest for each of the chats with pending notifications, split across messages if too long.
+
+Items are removed from the store once their message is emitted. Items of the message that cannot be emitted
+and the ones after are kept for the next digest, those already emitted are not sent again.
+Span of the digest is in the timezone of the first device that notified the chat
+*/
+func (d *Digest) Flush() {
+	d.mu.Lock()
+	pending, since := d.pending, d.since
+	d.pending, d.since = map[string]*chatDigest{}, time.Now()
+	d.mu.Unlock()
+	for chatID, cd := range pending {
+		title := fmt.Sprintf("*Digest* %s - %s", since.In(cd.loc).Format("15:04"), time.Now().In(cd.loc).Format("15:04"))
+		var err error
+		sent, kept := []DigestItem{}, []DigestItem{}
+		for _, part := range cd.parts(title, telegram.MaxMessageLen) {
+			if err == nil {
+				err = d.emit(chatID, part.txt)
+			}
+			if err != nil {
+				kept = append(kept, part.items...)
+				continue
+			}
+			sent = append(sent, part.items...)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"chat_id": chatID,
+				"sent":    len(sent),
+				"kept":    len(kept),
+				"err":     err,
+			}).Error("failed to emit digest, rest kept for the next")
+			replaced := []string{}
+			d.mu.Lock()
+			for _, item := range kept {
+				if id, ok := d.collect(item); ok {
+					replaced = append(replaced, id)
+				}
+			}
+			d.mu.Unlock()
+			if d.store != nil {
+				d.store.Delete(replaced...)
+			}
+		}
+		if d.store == nil {
+			continue
+		}
+		ids := []string{}
+		for _, item := range sent {
+			ids = append(ids, item.ID)
+		}
+		if err := d.store.Delete(ids...); err != nil {
+			log.WithFields(log.Fields{
+				"chat_id": chatID,
+				"err":     err,
+			}).Error("failed to remove digest items that were sent")
+		}
+	}
+}
+
+/* Start : digests are flushed every interval till Stop */
+func (d *Digest) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		tick := time.NewTicker(d.interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				d.Flush()
+			case <-d.quit:
+				return
+			}
+		}
+	}()
+}
+
+/* Stop : stops the interval and flushes whatever is pending */
+func (d *Digest) Stop() {
+	close(d.quit)
+	d.wg.Wait()
+	d.Flush()
+}
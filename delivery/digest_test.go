@@ -0,0 +1,123 @@
+package delivery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigest(t *testing.T) {
+	sent := map[string][]string{}
+	d := NewDigest(time.Hour, []string{"-100"}, []string{"b8:27:eb:00:00:02"}, nil, func(chatID, txt string) error {
+		sent[chatID] = append(sent[chatID], txt)
+		return nil
+	})
+	assert.True(t, d.Covers("-100", "b8:27:eb:00:00:01"), "Chat in digest mode")
+	assert.True(t, d.Covers("-200", "b8:27:eb:00:00:02"), "Device in digest mode")
+	assert.False(t, d.Covers("-200", "b8:27:eb:00:00:01"))
+
+	pump := DigestItem{DevID: "b8:27:eb:00:00:01", Header: "*Pump-I*", At: time.Now()}
+	add := func(typ, txt string, event bool) {
+		item := pump
+		item.Typ, item.Txt, item.Event = typ, txt, event
+		assert.Nil(t, d.Add("-100", item))
+	}
+	add("gpiostat", "Relay: LOW", false)
+	add("cfgchange", "Config: 1", true)
+	add("gpiostat", "Relay: HIGH", false)
+	add("vitals", "CPU free: 80%", false)
+	add("cfgchange", "Config: 2", true)
+	d.Flush()
+
+	assert.Len(t, sent["-100"], 1, "Digest was expected in a single message")
+	msg := sent["-100"][0]
+	assert.NotContains(t, msg, "Relay: LOW", "Only the latest gpiostat was expected")
+	for _, txt := range []string{"*Digest*", "*Pump-I*", "Relay: HIGH", "CPU free: 80%", "Config: 1", "Config: 2"} {
+		assert.Contains(t, msg, txt)
+	}
+	assert.Less(t, strings.Index(msg, "Config: 1"), strings.Index(msg, "Config: 2"), "Events were expected in order")
+
+	sent = map[string][]string{}
+	d.Flush()
+	assert.Len(t, sent, 0, "Nothing was expected after the digest was sent")
+
+	for i := 0; i < 300; i++ {
+		add("cfgchange", fmt.Sprintf("Config: %d\nTickAt: 12:00\nInterval: 7200", i), true)
+	}
+	d.Stop()
+	assert.Greater(t, len(sent["-100"]), 1, "Long digest was expected to be split")
+	for _, msg := range sent["-100"] {
+		assert.LessOrEqual(t, len([]rune(msg)), telegram.MaxMessageLen)
+	}
+}
+
+func TestDigestPersisted(t *testing.T) {
+	st := tempStore(t)
+	at := time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC).In(time.FixedZone("IST", 5*60*60+30*60))
+	d := NewDigest(time.Hour, []string{"-100"}, nil, st.Digests(), func(chatID, txt string) error { return nil })
+	for i, txt := range []string{"Relay: LOW", "Relay: HIGH"} {
+		assert.Nil(t, d.Add("-100", DigestItem{DevID: "b8:27:eb:00:00:01", Header: "*Pump-I*", Typ: "gpiostat", Txt: txt, At: at.Add(time.Duration(i) * time.Minute)}))
+	}
+	assert.Nil(t, d.Add("-100", DigestItem{DevID: "b8:27:eb:00:00:01", Header: "*Pump-I*", Typ: "cfgchange", Txt: "Config: 1", At: at, Event: true}))
+	items, _ := st.Digests().List()
+	assert.Len(t, items, 2, "Replaced gpiostat was expected to be removed from the store")
+
+	// as if the pod crashed before the digest was sent, and the first digest after the restart fails
+	failing := true
+	sent := []string{}
+	d = NewDigest(time.Hour, []string{"-100"}, nil, st.Digests(), func(chatID, txt string) error {
+		if failing {
+			return fmt.Errorf("delivery queue is full")
+		}
+		sent = append(sent, txt)
+		return nil
+	})
+	assert.Nil(t, d.Restore())
+	d.Flush()
+	items, _ = st.Digests().List()
+	assert.Len(t, items, 2, "Items were expected to be kept when the digest could not be emitted")
+
+	failing = false
+	d.Flush()
+	assert.Len(t, sent, 1)
+	for _, txt := range []string{"Relay: HIGH", "Config: 1", "gpiostat (11:31)", "cfgchange (11:30)"} {
+		assert.Contains(t, sent[0], txt, "Times were expected in the timezone of the device")
+	}
+	items, _ = st.Digests().List()
+	assert.Len(t, items, 0, "Items were expected to be removed once the digest was emitted")
+
+	// digest split across messages, where the second message cannot be emitted
+	calls := 0
+	sent = []string{}
+	d = NewDigest(time.Hour, []string{"-100"}, nil, st.Digests(), func(chatID, txt string) error {
+		calls++
+		if calls == 2 {
+			return fmt.Errorf("delivery queue is full")
+		}
+		sent = append(sent, txt)
+		return nil
+	})
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, d.Add("-100", DigestItem{DevID: "b8:27:eb:00:00:01", Header: "*Pump-I*", Typ: "cfgchange", Txt: fmt.Sprintf("Config: %d\nTickAt: 12:00\nInterval: 7200", i), At: at.Add(time.Duration(i) * time.Second), Event: true}))
+	}
+	d.Flush()
+	assert.Len(t, sent, 1, "Messages after the one that failed were not expected")
+	items, _ = st.Digests().List()
+	assert.NotEmpty(t, items)
+	assert.Less(t, len(items), 300, "Items of the message emitted were expected to be removed")
+	d.Flush()
+	assert.Greater(t, len(sent), 2)
+	all := strings.Join(sent, "\n")
+	for i := 0; i < 300; i++ {
+		assert.Equal(t, 1, strings.Count(all, fmt.Sprintf("Config: %d\n", i)), "Config %d was expected in the digests exactly once", i)
+	}
+	for _, msg := range sent {
+		assert.True(t, strings.HasPrefix(msg, "*Digest*") || strings.HasPrefix(msg, "*Pump-I*"), "Device details were expected atop each message")
+	}
+	items, _ = st.Digests().List()
+	assert.Len(t, items, 0)
+}
@@ -0,0 +1,86 @@
+package delivery
+
+/* Devices retry their notifications when they dont get a timely response, each retry would otherwise be another telegram message.
+Devices can send an idempotency key (header or the notification id), the result for the key is remembered for a window
+and repeats within the window get the same result without the message being sent again. */
+import (
+	"sync"
+	"time"
+)
+
+var (
+	/*
+		NewIdempotency : keys are remembered per device for the window */
+	NewIdempotency = func(window time.Duration) *Idempotency {
+		return &Idempotency{
+			window:    window,
+			keys:      map[string]*idemEntry{},
+			lastPrune: time.Now(),
+		}
+	}
+)
+
+// Result : response as was sent to the device for the key
+type Result struct {
+	Status int
+	Body   map[string]interface{}
+}
+
+type idemEntry struct {
+	result *Result // nil while the first request with the key is still being processed
+	at     time.Time
+}
+
+type Idempotency struct {
+	mu        sync.Mutex
+	window    time.Duration
+	keys      map[string]*idemEntry // device id/key
+	lastPrune time.Time
+}
+
+/* prune : drops the keys outside the window, not more than once a minute */
+func (idm *Idempotency) prune(now time.Time) {
+	if now.Sub(idm.lastPrune) < time.Minute {
+		return
+	}
+	for k, e := range idm.keys {
+		if now.Sub(e.at) > idm.window {
+			delete(idm.keys, k)
+		}
+	}
+	idm.lastPrune = now
+}
+
+/*
+	Claim : claims the key for the device, true when the key is new (or outside the window) and the request is to be processed.
+
+When not claimed, the result of the original request is returned, nil result indicates the original is still being processed
+*/
+func (idm *Idempotency) Claim(devid, key string) (*Result, bool) {
+	idm.mu.Lock()
+	defer idm.mu.Unlock()
+	now := time.Now()
+	idm.prune(now)
+	k := devid + "/" + key
+	if e, ok := idm.keys[k]; ok && now.Sub(e.at) <= idm.window {
+		return e.result, false
+	}
+	idm.keys[k] = &idemEntry{at: now}
+	return nil, true
+}
+
+/* Remember : result for the claimed key, repeats in the window get this result */
+func (idm *Idempotency) Remember(devid, key string, result *Result) {
+	idm.mu.Lock()
+	defer idm.mu.Unlock()
+	if e, ok := idm.keys[devid+"/"+key]; ok {
+		e.result = result
+	}
+}
+
+/* Forget : releases the claimed key, typically when the request failed and the device is expected to retry */
+func (idm *Idempotency) Forget(devid, key string) {
+	idm.mu.Lock()
+	defer idm.mu.Unlock()
+	delete(idm.keys, devid+"/"+key)
+}
@@ -0,0 +1,36 @@
+package delivery
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	idm := NewIdempotency(50 * time.Millisecond)
+	devid := "b8:27:eb:a5:be:48"
+
+	_, claimed := idm.Claim(devid, "3f2a")
+	assert.True(t, claimed, "New key was expected to be claimed")
+	res, claimed := idm.Claim(devid, "3f2a")
+	assert.False(t, claimed, "Repeat key was not expected to be claimed")
+	assert.Nil(t, res, "Result was not expected while the original is being processed")
+
+	idm.Remember(devid, "3f2a", &Result{Status: http.StatusAccepted, Body: map[string]interface{}{"delivery_id": "a1"}})
+	res, claimed = idm.Claim(devid, "3f2a")
+	assert.False(t, claimed)
+	assert.Equal(t, "a1", res.Body["delivery_id"], "Repeat was expected to get the original result")
+
+	_, claimed = idm.Claim("b8:27:eb:00:00:01", "3f2a")
+	assert.True(t, claimed, "Keys are per device")
+
+	idm.Forget(devid, "3f2a")
+	_, claimed = idm.Claim(devid, "3f2a")
+	assert.True(t, claimed, "Forgotten key was expected to be claimed again")
+
+	time.Sleep(60 * time.Millisecond)
+	_, claimed = idm.Claim(devid, "3f2a")
+	assert.True(t, claimed, "Key outside the window was expected to be claimed again")
+}
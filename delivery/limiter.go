@@ -0,0 +1,178 @@
+package delivery
+
+/* Token bucket rate limiter in front of the telegram sendMessage call.
+Telegram throttles bots to about 20 messages per minute per group and about 30 messages per second overall.
+Messages over the chat limit are put off till their turn instead of failing with 429, the workers meanwhile send to the other chats.
+Only the global limit, which is a wait of a second at the most, is waited upon */
+import (
+	"sync"
+	"time"
+)
+
+const (
+	maxIdleBuckets = 256 // beyond which chat buckets that have refilled completely are pruned
+)
+
+var (
+	/*
+		NewLimiter : a global bucket and one bucket per chat
+		globalPerSec	: messages per second across all chats
+		chatPerMin		: messages per minute for any single chat
+		chatBurst		: messages that can be sent back to back to a single chat */
+	NewLimiter = func(globalPerSec, chatPerMin float64, chatBurst int) *Limiter {
+		if chatBurst < 1 {
+			chatBurst = 1
+		}
+		return &Limiter{
+			global:    newBucket(globalPerSec, globalPerSec),
+			chats:     map[string]*bucket{},
+			chatRate:  chatPerMin / 60,
+			chatBurst: float64(chatBurst),
+		}
+	}
+)
+
+// bucket : tokens can go negative, which is then the debt that the waiting callers are paying off
+type bucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64 // tokens per second
+	last     time.Time
+	waiting  int // callers currently waiting on this bucket
+}
+
+func newBucket(rate, capacity float64) *bucket {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &bucket{tokens: capacity, capacity: capacity, rate: rate, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+/* reserve : takes a token, and returns the time to wait before the token is actually available */
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// BucketStats : state of a single bucket as seen from the admin endpoint
+type BucketStats struct {
+	Tokens     float64 `json:"tokens"`       // tokens available, negative when callers are waiting
+	Capacity   float64 `json:"capacity"`     // maximum burst
+	RatePerSec float64 `json:"rate_per_sec"` // refill rate
+	Waiting    int     `json:"waiting"`      // messages currently waiting on the bucket
+}
+
+// LimiterStats : state of the limiter as seen from the admin endpoint
+type LimiterStats struct {
+	Global BucketStats            `json:"global"`
+	Chats  map[string]BucketStats `json:"chats"`
+}
+
+type Limiter struct {
+	mu        sync.Mutex
+	global    *bucket
+	chats     map[string]*bucket
+	chatRate  float64
+	chatBurst float64
+}
+
+/* chat : bucket for the chat, made afresh if not already present */
+func (l *Limiter) chat(chatID string) *bucket {
+	b, ok := l.chats[chatID]
+	if !ok {
+		if len(l.chats) >= maxIdleBuckets {
+			l.prune(time.Now())
+		}
+		b = newBucket(l.chatRate, l.chatBurst)
+		l.chats[chatID] = b
+	}
+	return b
+}
+
+/* prune : chat buckets that are full and nobody waiting on them are as good as new */
+func (l *Limiter) prune(now time.Time) {
+	for id, b := range l.chats {
+		b.refill(now)
+		if b.waiting == 0 && b.tokens >= b.capacity {
+			delete(l.chats, id)
+		}
+	}
+}
+
+/* wait : reserves a token on the bucket and waits for it, false if quit before the wait is over */
+func (l *Limiter) wait(pick func() *bucket, quit <-chan struct{}) bool {
+	l.mu.Lock()
+	b := pick()
+	d := b.reserve(time.Now())
+	if d == 0 {
+		l.mu.Unlock()
+		return true
+	}
+	b.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		b.waiting--
+		l.mu.Unlock()
+	}()
+	select {
+	case <-time.After(d):
+		return true
+	case <-quit:
+		return false
+	}
+}
+
+/*
+	Reserve : takes a token from the chat bucket, and returns the time after which the message can be sent to the chat.
+
+0 when it can be sent right away. The token is held for the message, it is sent after the wait without reserving again
+*/
+func (l *Limiter) Reserve(chatID string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.chat(chatID)
+	d := b.reserve(time.Now())
+	if d > 0 {
+		b.waiting++
+		time.AfterFunc(d, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			b.waiting--
+		})
+	}
+	return d
+}
+
+/* WaitGlobal : blocks till a message can be sent without breaching the global limit, false if quit before the wait is over */
+func (l *Limiter) WaitGlobal(quit <-chan struct{}) bool {
+	return l.wait(func() *bucket { return l.global }, quit)
+}
+
+/* Stats : snapshot of the global and all the chat buckets */
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	stats := func(b *bucket) BucketStats {
+		b.refill(now)
+		return BucketStats{Tokens: b.tokens, Capacity: b.capacity, RatePerSec: b.rate, Waiting: b.waiting}
+	}
+	result := LimiterStats{Global: stats(l.global), Chats: map[string]BucketStats{}}
+	for id, b := range l.chats {
+		result.Chats[id] = stats(b)
+	}
+	return result
+}
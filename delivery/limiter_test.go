@@ -0,0 +1,42 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("chat_burst_then_wait", func(t *testing.T) {
+		l := NewLimiter(1000, 600, 2) // 10 messages a second per chat, 2 back to back
+		for i := 0; i < 2; i++ {
+			assert.Zero(t, l.Reserve("-100"), "Burst was expected to go through without waiting")
+		}
+		wait := l.Reserve("-100")
+		assert.InDelta(t, 100*time.Millisecond, wait, float64(20*time.Millisecond), "Message over the burst was expected to wait")
+		assert.Equal(t, 1, l.Stats().Chats["-100"].Waiting)
+		assert.Eventually(t, func() bool { return l.Stats().Chats["-100"].Waiting == 0 }, time.Second, 5*time.Millisecond)
+		// other chats are not held up by the busy one
+		assert.Zero(t, l.Reserve("-200"))
+	})
+	t.Run("global_limit", func(t *testing.T) {
+		l := NewLimiter(2, 6000, 100)
+		start := time.Now()
+		for range []string{"-100", "-200", "-300"} {
+			assert.True(t, l.WaitGlobal(nil))
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond, "Global limit was expected to hold up the third message")
+	})
+	t.Run("quit_while_waiting", func(t *testing.T) {
+		l := NewLimiter(1.0/60, 1, 1) // 1 message a minute
+		assert.True(t, l.WaitGlobal(nil))
+		quit := make(chan struct{})
+		go func() {
+			assert.Eventually(t, func() bool { return l.Stats().Global.Waiting == 1 }, time.Second, 5*time.Millisecond)
+			close(quit)
+		}()
+		assert.False(t, l.WaitGlobal(quit), "Wait was expected to be abandoned on quit")
+		assert.Equal(t, 0, l.Stats().Global.Waiting)
+	})
+}
@@ -0,0 +1,497 @@
+package delivery
+
+/* In-process delivery queue between the device notification handler and the telegram sendMessage call.
+Handlers only validate and enqueue, a pool of workers then posts the messages to telegram.
+This way devices on the ground are not held up when the telegram server is slow. */
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/breaker"
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrQueueFull   = fmt.Errorf("delivery queue is full")
+	ErrQueueClosed = fmt.Errorf("delivery queue is closed")
+)
+
+var (
+	/*
+		NewJob : a single message to be delivered to a single chat
+		devid	: device that raised the notification
+		typ		: type of the notification - cfgchange, gpiostat, vitals
+		payload	: notification as it was received from the device
+		msg		: message as it will be posted to telegram */
+	NewJob = func(devid, typ string, payload []byte, msg telegram.BotMessage) *Job {
+		return &Job{
+			ID:         newJobID(),
+			DevID:      devid,
+			Typ:        typ,
+			Payload:    payload,
+			Msg:        msg,
+			AcceptedAt: time.Now(),
+		}
+	}
+	/*
+		NewQueue : makes a new delivery queue, workers are not started until Start is called
+		depth	: number of jobs that can be waiting before the queue rejects new ones
+		workers	: number of goroutines posting messages concurrently
+		snd		: the one that actually delivers the message
+		ob		: persistence for jobs till they are delivered
+		dl		: persistence for jobs that could not be delivered */
+	NewQueue = func(depth, workers int, snd Sender, ob Outbox, dl DeadLetters) *Queue {
+		if depth < 1 {
+			depth = 1
+		}
+		if workers < 1 {
+			workers = 1
+		}
+		return &Queue{
+			Retry:    DefaultRetry,
+			quit:     make(chan struct{}),
+			stop:     make(chan struct{}),
+			inflight: map[string]bool{},
+			jobs:     make(chan *Job, depth),
+			workers:  workers,
+			sender:   snd,
+			outbox:   ob,
+			dead:     dl,
+		}
+	}
+)
+
+// Sender : anything that can post the bot message, typically the telegram bot client
+type Sender interface {
+	SendMessage(bm *telegram.BotMessage) error
+}
+
+// Job : unit of delivery, one message for one chat
+type Job struct {
+	ID         string              `json:"id"`                  // delivery id that is sent back to the device
+	DevID      string              `json:"devid"`               // device that raised the notification
+	Typ        string              `json:"typ"`                 // type of notification
+	Payload    json.RawMessage     `json:"payload,omitempty"`   // notification as received from the device
+	Msg        telegram.BotMessage `json:"msg"`                 // message as posted to telegram
+	AcceptedAt time.Time           `json:"accepted_at"`         // time at which the notification was accepted from the device
+	Attempts   int                 `json:"attempts"`            // number of times delivery was attempted
+	LastErr    string              `json:"last_err,omitempty"`  // error from the last failed attempt
+	FailedAt   *time.Time          `json:"failed_at,omitempty"` // time at which the delivery was given up
+
+	reserved bool // chat rate limit token is held for the job, it was put off till its turn
+}
+
+type Queue struct {
+	Retry   RetryPolicy      // policy for failed sends, to be set before Start
+	Limiter *Limiter         // rate limits for sending, nil for no limits. To be set before Start
+	OnDead  func(j *Job)     // called when the job is moved to dead letters, nil when not needed. To be set before Start
+	Breaker *breaker.Breaker // breaker around the sender, jobs are parked in the outbox while open. nil for no breaker, to be set before Start
+	jobs    chan *Job
+	workers int
+	sender  Sender
+	outbox  Outbox
+	dead    DeadLetters
+	wg      sync.WaitGroup
+	mu      sync.RWMutex // guards closed, so that no job is sent on a closed channel
+	closed  bool
+	quit    chan struct{} // closed when the workers are to give up waiting on retries
+	stop    chan struct{} // closed when the parked jobs are no longer to be fed back to the queue
+
+	imu      sync.Mutex
+	inflight map[string]bool // ids of jobs on the queue or with the workers, the rest in the outbox are parked
+}
+
+/* newJobID : random hex id, good enough to be unique for the lifetime of a delivery */
+func newJobID() string {
+	byt := make([]byte, 16)
+	if _, err := rand.Read(byt); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(byt)
+}
+
+/* Start : spins up the workers, each of them reads off the queue till its closed */
+func (q *Queue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func(wrkr int) {
+			defer q.wg.Done()
+			for j := range q.jobs {
+				q.deliver(wrkr, j)
+			}
+		}(i)
+	}
+	if q.Breaker != nil {
+		go q.unpark(time.Second)
+	}
+	log.WithFields(log.Fields{
+		"workers": q.workers,
+		"depth":   cap(q.jobs),
+	}).Info("Delivery queue started")
+}
+
+/*
+	deliver : attempts sending the job as per the retry policy.
+
+Jobs that cannot be delivered are moved to dead letters, while the ones abandoned on quitting stay in the outbox for a replay
+*/
+func (q *Queue) deliver(wrkr int, j *Job) {
+	putOff := false
+	defer func() {
+		if !putOff {
+			q.settle(j)
+		}
+	}()
+	for {
+		if q.Limiter != nil {
+			if !j.reserved {
+				if wait := q.Limiter.Reserve(j.Msg.ChatID); wait > 0 {
+					j.reserved, putOff = true, true
+					q.later(j, wait)
+					return // worker is free to send to the other chats in the meantime
+				}
+			}
+			j.reserved = false
+			if !q.Limiter.WaitGlobal(q.quit) {
+				return // stays in the outbox, shall be replayed on the next start
+			}
+		}
+		if q.Breaker != nil {
+			if err := q.Breaker.Allow(); err != nil {
+				log.WithFields(log.Fields{
+					"worker": wrkr,
+					"id":     j.ID,
+					"devid":  j.DevID,
+				}).Warn("telegram breaker open, job parked in outbox")
+				return // stays in the outbox, fed back once the breaker is ready
+			}
+		}
+		j.Attempts++
+		err := q.sender.SendMessage(&j.Msg)
+		q.report(err)
+		if err == nil {
+			break
+		}
+		wait, retry := q.Retry.Next(j.Attempts, err)
+		log.WithFields(log.Fields{
+			"worker":   wrkr,
+			"id":       j.ID,
+			"devid":    j.DevID,
+			"typ":      j.Typ,
+			"attempts": j.Attempts,
+			"retry":    retry,
+			"wait":     wait,
+			"err":      err,
+		}).Error("failed to deliver notification")
+		if !retry {
+			q.bury(j, err)
+			return
+		}
+		select {
+		case <-time.After(wait):
+		case <-q.quit:
+			return // stays in the outbox, shall be replayed on the next start
+		}
+	}
+	q.remove(j)
+	log.WithFields(log.Fields{
+		"worker":   wrkr,
+		"id":       j.ID,
+		"devid":    j.DevID,
+		"typ":      j.Typ,
+		"attempts": j.Attempts,
+		"delay":    time.Since(j.AcceptedAt),
+	}).Debug("Notification delivered")
+}
+
+/* report : outcome of the send to the breaker. Telegram responding with a client error is still telegram being up */
+func (q *Queue) report(err error) {
+	if q.Breaker == nil {
+		return
+	}
+	var apiErr *telegram.APIError
+	if err == nil || (errors.As(err, &apiErr) && apiErr.StatusCode < 500) {
+		q.Breaker.Success()
+		return
+	}
+	q.Breaker.Failure()
+}
+
+/* track : marks the job as on the queue, false if it already is */
+func (q *Queue) track(j *Job) bool {
+	q.imu.Lock()
+	defer q.imu.Unlock()
+	if q.inflight[j.ID] {
+		return false
+	}
+	q.inflight[j.ID] = true
+	return true
+}
+
+/*
+	claim : tracks the job read off the outbox, false if it is already on the queue or no longer in the outbox.
+
+Outbox could have been read before the job was delivered, and the job then is not to be sent again
+*/
+func (q *Queue) claim(j *Job) bool {
+	if !q.track(j) {
+		return false
+	}
+	if _, err := q.outbox.Get(j.ID); err != nil {
+		q.settle(j)
+		if !errors.Is(err, ErrJobNotFound) {
+			log.WithFields(log.Fields{
+				"id":  j.ID,
+				"err": err,
+			}).Error("failed to read job from outbox")
+		}
+		return false
+	}
+	return true
+}
+
+/* settle : job is done with the workers, delivered, buried or parked */
+func (q *Queue) settle(j *Job) {
+	q.imu.Lock()
+	defer q.imu.Unlock()
+	delete(q.inflight, j.ID)
+}
+
+/*
+	unpark : feeds the parked jobs from the outbox back to the queue whenever the breaker is ready.
+
+Feeding never blocks, jobs that find the queue full are picked up on the next tick
+*/
+func (q *Queue) unpark(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-tick.C:
+		}
+		if !q.Breaker.Ready() {
+			continue
+		}
+		pending, err := q.outbox.Pending()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("failed to read parked jobs from outbox")
+			continue
+		}
+		fed := 0
+		for _, j := range pending {
+			if !q.claim(j) {
+				continue
+			}
+			if !q.offer(j) {
+				q.settle(j)
+				break
+			}
+			fed++
+		}
+		if fed > 0 {
+			log.WithFields(log.Fields{
+				"count": fed,
+			}).Info("Parked jobs fed back to the queue")
+		}
+	}
+}
+
+/*
+	later : job is fed back to the queue once the wait is over, till then it stays tracked so that unpark and replay leave it alone.
+
+Jobs that find the queue closed stay in the outbox, and are replayed on the next start
+*/
+func (q *Queue) later(j *Job, wait time.Duration) {
+	time.AfterFunc(wait, func() {
+		q.mu.RLock()
+		closed := q.closed
+		q.mu.RUnlock()
+		if closed {
+			q.settle(j)
+			return
+		}
+		if !q.offer(j) {
+			q.later(j, 100*time.Millisecond) // queue is full, tried again shortly
+		}
+	})
+}
+
+/* offer : puts the job on the queue without blocking, false if the queue is full or closed */
+func (q *Queue) offer(j *Job) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+/* bury : moves the job from the outbox to the dead letters, failing which the job is lost and only the log remains */
+func (q *Queue) bury(j *Job, err error) {
+	now := time.Now()
+	j.LastErr = err.Error()
+	j.FailedAt = &now
+	if err := q.dead.Put(j); err != nil {
+		log.WithFields(log.Fields{
+			"id":  j.ID,
+			"err": err,
+		}).Error("failed to move job to dead letters")
+	}
+	q.remove(j)
+	if q.OnDead != nil {
+		q.OnDead(j)
+	}
+}
+
+func (q *Queue) remove(j *Job) {
+	if err := q.outbox.Delete(j.ID); err != nil {
+		log.WithFields(log.Fields{
+			"id":  j.ID,
+			"err": err,
+		}).Error("failed to remove job from outbox")
+	}
+}
+
+/*
+	Enqueue : persists the job in the outbox and puts it on the queue without blocking.
+
+Incase the queue is full or closed the job is rejected and removed from the outbox.
+While the breaker is open the job is only parked in the outbox, and is still accepted
+*/
+func (q *Queue) Enqueue(j *Job) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if err := q.outbox.Put(j); err != nil {
+		return fmt.Errorf("failed to persist job in outbox %s", err)
+	}
+	if q.Breaker != nil && !q.Breaker.Ready() {
+		return nil // parked, unpark shall feed it once the breaker is ready
+	}
+	if !q.track(j) {
+		return nil // picked up by unpark in the meantime
+	}
+	select {
+	case q.jobs <- j:
+		return nil
+	default:
+		q.settle(j)
+		if err := q.outbox.Delete(j.ID); err != nil {
+			log.WithFields(log.Fields{
+				"id":  j.ID,
+				"err": err,
+			}).Error("failed to remove rejected job from outbox")
+		}
+		return ErrQueueFull
+	}
+}
+
+/*
+	Replay : queues all the undelivered jobs from the outbox, typically on startup.
+
+Jobs are fed to the queue as and when there is room, hence this blocks till all of them are queued
+*/
+func (q *Queue) Replay() error {
+	pending, err := q.outbox.Pending()
+	if err != nil {
+		return fmt.Errorf("failed to read pending jobs from outbox %s", err)
+	}
+	if len(pending) > 0 {
+		log.WithFields(log.Fields{
+			"count": len(pending),
+		}).Info("Replaying undelivered jobs from outbox")
+	}
+	for _, j := range pending {
+		if !q.claim(j) {
+			continue // already fed back from being parked, or delivered since
+		}
+		q.mu.RLock()
+		if q.closed {
+			q.mu.RUnlock()
+			q.settle(j)
+			return ErrQueueClosed // remaining jobs stay in the outbox
+		}
+		q.jobs <- j
+		q.mu.RUnlock()
+	}
+	return nil
+}
+
+/*
+	ReplayDeadLetter : queues the dead job afresh, it is removed from the dead letters only once queued.
+
+Attempts and the last error are reset, the delivery id remains the same
+*/
+func (q *Queue) ReplayDeadLetter(id string) error {
+	j, err := q.dead.Get(id)
+	if err != nil {
+		return err
+	}
+	j.Attempts, j.LastErr, j.FailedAt = 0, "", nil
+	if err := q.Enqueue(j); err != nil {
+		return err
+	}
+	return q.dead.Delete(id)
+}
+
+/* ReplayDeadLetters : queues all the dead jobs afresh, stops at the first job that cannot be queued. Count of jobs queued is returned */
+func (q *Queue) ReplayDeadLetters() (int, error) {
+	dead, err := q.dead.List()
+	if err != nil {
+		return 0, err
+	}
+	for i, j := range dead {
+		if err := q.ReplayDeadLetter(j.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(dead), nil
+}
+
+/*
+	Close : stops accepting new jobs and waits for the workers to drain the queue.
+
+Incase the context is done before the queue is drained, the count of undelivered jobs is reported as an error.
+Jobs put off for the chat rate limit are not waited on, they stay in the outbox and are replayed on the next start.
+Close is to be called only once
+*/
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+		close(q.stop)
+	}
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Info("Delivery queue drained")
+		return nil
+	case <-ctx.Done():
+		close(q.quit) // workers waiting on retries give up, jobs stay in the outbox
+		return fmt.Errorf("delivery queue not drained, %d jobs pending: %s", len(q.jobs), ctx.Err())
+	}
+}
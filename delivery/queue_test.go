@@ -0,0 +1,270 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/breaker"
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSender : records all the messages that were sent, optionally blocking till released or failing
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []*telegram.BotMessage
+	hold chan struct{}
+	fail bool
+}
+
+func (fs *fakeSender) SendMessage(bm *telegram.BotMessage) error {
+	if fs.hold != nil {
+		<-fs.hold
+	}
+	if fs.fail {
+		return fmt.Errorf("telegram server responded with status %d", 502)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.sent = append(fs.sent, bm)
+	return nil
+}
+
+func (fs *fakeSender) count() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.sent)
+}
+
+func tempStore(t *testing.T) *BoltStore {
+	st, err := OpenBoltStore(filepath.Join(t.TempDir(), "outbox.db"))
+	assert.Nil(t, err, "Unexpected error when opening store")
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func newTestQueue(t *testing.T, depth, workers int, snd Sender) *Queue {
+	st := tempStore(t)
+	return NewQueue(depth, workers, snd, st.Outbox(), st.DeadLetters())
+}
+
+func TestQueue(t *testing.T) {
+	t.Run("drain_on_close", func(t *testing.T) {
+		snd := &fakeSender{}
+		q := newTestQueue(t, 10, 3, snd)
+		q.Start()
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "gpiostat", nil, telegram.BotMessage{ChatID: "-100", Txt: "test"})), "Unexpected error when queuing")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		assert.Nil(t, q.Close(ctx), "Unexpected error when draining the queue")
+		assert.Equal(t, 10, snd.count(), "Unexpected count of messages delivered")
+		assert.ErrorIs(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "gpiostat", nil, telegram.BotMessage{})), ErrQueueClosed, "Expected closed queue to reject jobs")
+	})
+	t.Run("full_queue", func(t *testing.T) {
+		snd := &fakeSender{hold: make(chan struct{})}
+		q := newTestQueue(t, 1, 1, snd) // worker holds one job, queue holds another
+		q.Start()
+		assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{})))
+		assert.Eventually(t, func() bool { return len(q.jobs) == 0 }, time.Second, 10*time.Millisecond, "worker did not pick the job")
+		assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{})))
+		assert.ErrorIs(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{})), ErrQueueFull, "Expected full queue to reject jobs")
+		close(snd.hold)
+		assert.Nil(t, q.Close(context.Background()))
+		assert.Equal(t, 2, snd.count())
+	})
+	t.Run("busy_chat_put_off", func(t *testing.T) {
+		snd := &fakeSender{}
+		st := tempStore(t)
+		q := NewQueue(10, 1, snd, st.Outbox(), st.DeadLetters())
+		q.Limiter = NewLimiter(1000, 1, 1) // a message a minute per chat
+		q.Start()
+		for _, chat := range []string{"-100", "-100", "-200"} {
+			assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{ChatID: chat, Txt: "test"})))
+		}
+		assert.Eventually(t, func() bool { return snd.count() == 2 }, time.Second, 10*time.Millisecond, "Other chat was not expected to wait on the busy one")
+		snd.mu.Lock()
+		assert.Equal(t, "-200", snd.sent[1].ChatID)
+		snd.mu.Unlock()
+		assert.Nil(t, q.Close(context.Background()))
+		pending, _ := st.Outbox().Pending()
+		assert.Len(t, pending, 1, "Message put off was expected to stay in the outbox")
+	})
+	t.Run("replay_undelivered", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outbox.db")
+		st, err := OpenBoltStore(path)
+		assert.Nil(t, err)
+		q := NewQueue(10, 2, &fakeSender{fail: true}, st.Outbox(), st.DeadLetters())
+		q.Retry = RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour, MaxDelay: time.Hour} // workers are left waiting on retries
+		q.Start()
+		for i := 0; i < 5; i++ {
+			assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "cfgchange", nil, telegram.BotMessage{ChatID: "-100", Txt: "test"})))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		assert.NotNil(t, q.Close(ctx), "Queue was expected to not drain")
+		assert.Nil(t, st.Close())
+
+		// as if the pod was restarted
+		st, err = OpenBoltStore(path)
+		assert.Nil(t, err)
+		defer st.Close()
+		pending, err := st.Outbox().Pending()
+		assert.Nil(t, err)
+		assert.Len(t, pending, 5, "Undelivered jobs were expected in the outbox")
+		snd := &fakeSender{}
+		q = NewQueue(2, 2, snd, st.Outbox(), st.DeadLetters())
+		q.Start()
+		assert.Nil(t, q.Replay())
+		assert.Nil(t, q.Close(context.Background()))
+		assert.Equal(t, 5, snd.count())
+		pending, err = st.Outbox().Pending()
+		assert.Nil(t, err)
+		assert.Len(t, pending, 0, "Outbox was expected to be empty after delivery")
+	})
+	t.Run("dead_letters", func(t *testing.T) {
+		st := tempStore(t)
+		snd := &rejectingSender{}
+		q := NewQueue(10, 1, snd, st.Outbox(), st.DeadLetters())
+		q.Start()
+		payload := []byte(`{"device_name":"Aquaponics pump control-I"}`)
+		j := NewJob("b8:27:eb:a5:be:48", "gpiostat", payload, telegram.BotMessage{ChatID: "-100", Txt: "test"})
+		assert.Nil(t, q.Enqueue(j))
+		assert.Eventually(t, func() bool {
+			dead, _ := st.DeadLetters().List()
+			pending, _ := st.Outbox().Pending()
+			return len(dead) == 1 && len(pending) == 0
+		}, time.Second, 10*time.Millisecond, "Job was expected to be moved from outbox to dead letters")
+		dead, err := st.DeadLetters().Get(j.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, dead.Attempts, "Client errors are not to be retried")
+		assert.Equal(t, "-100", dead.Msg.ChatID)
+		assert.JSONEq(t, string(payload), string(dead.Payload))
+		assert.Contains(t, dead.LastErr, "chat not found")
+
+		snd.accept()
+		assert.Nil(t, q.ReplayDeadLetter(j.ID))
+		assert.Nil(t, q.Close(context.Background()))
+		_, err = st.DeadLetters().Get(j.ID)
+		assert.ErrorIs(t, err, ErrJobNotFound)
+		assert.ErrorIs(t, q.ReplayDeadLetter(j.ID), ErrJobNotFound)
+	})
+	t.Run("parked_while_breaker_open", func(t *testing.T) {
+		st := tempStore(t)
+		snd := &downSender{}
+		q := NewQueue(10, 1, snd, st.Outbox(), st.DeadLetters())
+		q.Retry = RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond}
+		q.Breaker = breaker.NewBreaker("telegram", 1, 200*time.Millisecond)
+		q.Start()
+		assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{ChatID: "-100", Txt: "test"})))
+		assert.Eventually(t, func() bool { return q.Breaker.State() == breaker.OPEN }, time.Second, 10*time.Millisecond, "Breaker was expected to open")
+		assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{ChatID: "-100", Txt: "test"})), "Jobs are to be accepted while the breaker is open")
+		pending, err := st.Outbox().Pending()
+		assert.Nil(t, err)
+		assert.Len(t, pending, 2, "Jobs were expected to be parked in the outbox")
+
+		snd.up()
+		assert.Eventually(t, func() bool {
+			pending, _ := st.Outbox().Pending()
+			return snd.count() == 2 && len(pending) == 0
+		}, 5*time.Second, 50*time.Millisecond, "Parked jobs were expected to be delivered once the breaker closed")
+		assert.Equal(t, breaker.CLOSED, q.Breaker.State())
+		assert.Nil(t, q.Close(context.Background()))
+	})
+	t.Run("delivered_not_unparked", func(t *testing.T) {
+		st := tempStore(t)
+		snd := &fakeSender{}
+		q := NewQueue(50, 4, snd, &staleOutbox{Outbox: st.Outbox()}, st.DeadLetters())
+		q.Breaker = breaker.NewBreaker("telegram", 1, 200*time.Millisecond)
+		q.Start()
+		for i := 0; i < 40; i++ {
+			assert.Nil(t, q.Enqueue(NewJob("b8:27:eb:a5:be:48", "vitals", nil, telegram.BotMessage{ChatID: "-100", Txt: fmt.Sprintf("test %d", i)})))
+		}
+		time.Sleep(1500 * time.Millisecond) // unpark has read the stale outbox at least once
+		assert.Nil(t, q.Close(context.Background()))
+		sent := map[string]int{}
+		for _, bm := range snd.sent {
+			sent[bm.Txt]++
+		}
+		assert.Len(t, sent, 40)
+		for txt, n := range sent {
+			assert.Equal(t, 1, n, "Job %q was expected to be sent exactly once", txt)
+		}
+	})
+}
+
+// staleOutbox : pending jobs are as they were when put, as if the outbox were read before the jobs were delivered
+type staleOutbox struct {
+	Outbox
+	mu    sync.Mutex
+	stale []*Job
+}
+
+func (so *staleOutbox) Put(j *Job) error {
+	so.mu.Lock()
+	cp := *j
+	so.stale = append(so.stale, &cp)
+	so.mu.Unlock()
+	return so.Outbox.Put(j)
+}
+
+func (so *staleOutbox) Pending() ([]*Job, error) {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	return append([]*Job{}, so.stale...), nil
+}
+
+// downSender : fails as an unreachable telegram server would, till up
+type downSender struct {
+	mu   sync.Mutex
+	isUp bool
+	sent int
+}
+
+func (ds *downSender) up() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.isUp = true
+}
+
+func (ds *downSender) count() int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.sent
+}
+
+func (ds *downSender) SendMessage(bm *telegram.BotMessage) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if !ds.isUp {
+		return fmt.Errorf("dial tcp: connection refused")
+	}
+	ds.sent++
+	return nil
+}
+
+// rejectingSender : fails as telegram would for a chat that does not exist, till accepting
+type rejectingSender struct {
+	mu    sync.Mutex
+	accpt bool
+}
+
+func (rs *rejectingSender) accept() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.accpt = true
+}
+
+func (rs *rejectingSender) SendMessage(bm *telegram.BotMessage) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if !rs.accpt {
+		return &telegram.APIError{ErrorCode: 400, Description: "Bad Request: chat not found"}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package delivery
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+)
+
+var (
+	// DefaultRetry : used by the queue unless set otherwise
+	DefaultRetry = RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+	}
+)
+
+// RetryPolicy : exponential backoff with jitter for sending messages to telegram
+type RetryPolicy struct {
+	MaxAttempts int           // including the first attempt, 1 would mean no retries
+	BaseDelay   time.Duration // delay before the first retry, doubles thereafter
+	MaxDelay    time.Duration // cap on the delay between 2 attempts
+}
+
+/*
+	Backoff : delay before the next attempt, when attempt number of attempts have failed.
+
+Delay doubles with each attempt upto MaxDelay, and is jittered between half and full of it
+so that workers failing together dont retry together
+*/
+func (rp RetryPolicy) Backoff(attempt int) time.Duration {
+	d := rp.BaseDelay
+	for i := 1; i < attempt && d < rp.MaxDelay; i++ {
+		d *= 2
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+/*
+	Next : given the error from the attempt, decides if a retry is due and how long to wait for it
+
+Telegram asking to wait (429 with retry_after) is honoured exactly, client errors are never retried
+*/
+func (rp RetryPolicy) Next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= rp.MaxAttempts {
+		return 0, false
+	}
+	var ae *telegram.APIError
+	if errors.As(err, &ae) {
+		if !ae.Retryable() {
+			return 0, false
+		}
+		if ra := ae.RetryAfter(); ra > 0 {
+			return ra, true
+		}
+	}
+	return rp.Backoff(attempt), true
+}
@@ -0,0 +1,40 @@
+package delivery
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 6, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	floodCtrl := &telegram.APIError{ErrorCode: 429, Description: "Too Many Requests: retry after 17"}
+	floodCtrl.Parameters.RetryAfter = 17
+	data := []struct {
+		name    string
+		attempt int
+		err     error
+		retry   bool
+		minWait time.Duration
+		maxWait time.Duration
+	}{
+		{"network_error", 1, fmt.Errorf("dial tcp: i/o timeout"), true, 500 * time.Millisecond, time.Second},
+		{"backoff_doubles", 2, fmt.Errorf("dial tcp: i/o timeout"), true, time.Second, 2 * time.Second},
+		{"backoff_capped", 4, &telegram.APIError{ErrorCode: 502, Description: "Bad Gateway"}, true, 2500 * time.Millisecond, 5 * time.Second},
+		{"retry_after", 1, floodCtrl, true, 17 * time.Second, 17 * time.Second},
+		{"chat_not_found", 1, &telegram.APIError{ErrorCode: 400, Description: "Bad Request: chat not found"}, false, 0, 0},
+		{"bot_kicked", 1, &telegram.APIError{ErrorCode: 403, Description: "Forbidden: bot was kicked from the group chat"}, false, 0, 0},
+		{"max_attempts", 6, fmt.Errorf("dial tcp: i/o timeout"), false, 0, 0},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			wait, retry := rp.Next(d.attempt, d.err)
+			assert.Equal(t, d.retry, retry, "Unexpected retry decision")
+			assert.GreaterOrEqual(t, wait, d.minWait, "Wait shorter than expected")
+			assert.LessOrEqual(t, wait, d.maxWait, "Wait longer than expected")
+		})
+	}
+}
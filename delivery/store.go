@@ -0,0 +1,202 @@
+package delivery
+
+/* Persistence for the delivery jobs, on an embedded bolt file typically on a mounted volume.
+Outbox : jobs accepted from the devices are persisted here before the device gets its response.
+They are removed only once telegram confirms the delivery, and hence survive restarts of the pod.
+DeadLetters : jobs that could not be delivered inspite of retries, kept till they are replayed or discarded
+Digests : notifications collected for the next digest, kept till the digest is queued */
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrJobNotFound = fmt.Errorf("job not found")
+)
+
+var (
+	bktOutbox      = []byte("outbox")
+	bktDeadLetters = []byte("deadletters")
+	bktDigests     = []byte("digests")
+)
+
+var (
+	/*
+		OpenBoltStore : opens the bolt file, all the buckets are created if not already present
+		path : file path to the bolt database, created if not already present */
+	OpenBoltStore = func(path string) (*BoltStore, error) {
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 3 * time.Second})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open store %s: %s", path, err)
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, bkt := range [][]byte{bktOutbox, bktDeadLetters, bktDigests} {
+				if _, err := tx.CreateBucketIfNotExists(bkt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create store buckets %s", err)
+		}
+		return &BoltStore{db: db}, nil
+	}
+)
+
+// Outbox : persistence for jobs that are accepted but not yet delivered
+type Outbox interface {
+	Put(j *Job) error            // persists the job, overwrites if the job id exists
+	Get(id string) (*Job, error) // ErrJobNotFound when the job is delivered or buried
+	Delete(id string) error      // removes the job, no error if the job isnt found
+	Pending() ([]*Job, error)    // all the undelivered jobs, oldest first
+}
+
+// DeadLetters : persistence for jobs that failed delivery, along with the last error and attempts
+type DeadLetters interface {
+	Put(j *Job) error            // persists the job, overwrites if the job id exists
+	Get(id string) (*Job, error) // ErrJobNotFound when no such job
+	Delete(id string) error      // removes the job, no error if the job isnt found
+	List() ([]*Job, error)       // all the dead jobs, oldest first
+}
+
+// DigestItems : persistence for notifications accepted for the digest, so that they survive a restart till the digest is sent
+type DigestItems interface {
+	Put(item DigestItem) error   // persists the item, overwrites if the item id exists
+	Delete(ids ...string) error  // removes the items, no error if any of them isnt found
+	List() ([]DigestItem, error) // all the items, oldest first
+}
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func (bs *BoltStore) Outbox() Outbox {
+	return &boltJobs{db: bs.db, bkt: bktOutbox}
+}
+
+func (bs *BoltStore) DeadLetters() DeadLetters {
+	return &boltJobs{db: bs.db, bkt: bktDeadLetters}
+}
+
+func (bs *BoltStore) Digests() DigestItems {
+	return &boltDigests{db: bs.db}
+}
+
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+// boltJobs : jobs in a single bucket keyed on the job id
+type boltJobs struct {
+	db  *bolt.DB
+	bkt []byte
+}
+
+func (bj *boltJobs) Put(j *Job) error {
+	byt, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s", err)
+	}
+	return bj.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bj.bkt).Put([]byte(j.ID), byt)
+	})
+}
+
+func (bj *boltJobs) Get(id string) (*Job, error) {
+	j := &Job{}
+	err := bj.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bj.bkt).Get([]byte(id))
+		if v == nil {
+			return ErrJobNotFound
+		}
+		return json.Unmarshal(v, j)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (bj *boltJobs) Delete(id string) error {
+	return bj.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bj.bkt).Delete([]byte(id))
+	})
+}
+
+func (bj *boltJobs) List() ([]*Job, error) {
+	result := []*Job{}
+	err := bj.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bj.bkt).ForEach(func(k, v []byte) error {
+			j := &Job{}
+			if err := json.Unmarshal(v, j); err != nil {
+				return fmt.Errorf("failed to unmarshal job %s: %s", k, err)
+			}
+			result = append(result, j)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, k int) bool {
+		return result[i].AcceptedAt.Before(result[k].AcceptedAt)
+	})
+	return result, nil
+}
+
+func (bj *boltJobs) Pending() ([]*Job, error) {
+	return bj.List()
+}
+
+// boltDigests : digest items keyed on the item id
+type boltDigests struct {
+	db *bolt.DB
+}
+
+func (bd *boltDigests) Put(item DigestItem) error {
+	byt, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest item %s", err)
+	}
+	return bd.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bktDigests).Put([]byte(item.ID), byt)
+	})
+}
+
+func (bd *boltDigests) Delete(ids ...string) error {
+	return bd.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := tx.Bucket(bktDigests).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bd *boltDigests) List() ([]DigestItem, error) {
+	result := []DigestItem{}
+	err := bd.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bktDigests).ForEach(func(k, v []byte) error {
+			item := DigestItem{}
+			if err := json.Unmarshal(v, &item); err != nil {
+				return fmt.Errorf("failed to unmarshal digest item %s: %s", k, err)
+			}
+			result = append(result, item)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, k int) bool {
+		return result[i].At.Before(result[k].At)
+	})
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package delivery
+
+/* Suppression of repeated identical notifications.
+Devices that post the same status every minute would otherwise flood the group with identical messages.
+Content is fingerprinted per device and type of notification, repeats within the window are dropped
+and a summary is sent when the window closes or the content changes. */
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+var (
+	/*
+		NewSuppressor : repeats are suppressed for the window starting from the first notification sent */
+	NewSuppressor = func(window time.Duration) *Suppressor {
+		return &Suppressor{
+			window: window,
+			seen:   map[string]*seenEntry{},
+		}
+	}
+)
+
+// OnRepeat : called when the repeats are to be summarised, with the count of repeats dropped since the notification was sent
+type OnRepeat func(repeats int, since time.Time)
+
+type seenEntry struct {
+	fingerprint string
+	since       time.Time
+	repeats     int
+	onRepeat    OnRepeat // from the latest repeat, so that the summary carries the latest details
+	timer       *time.Timer
+}
+
+type Suppressor struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*seenEntry // device id/type of notification
+}
+
+func fingerprint(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+/* summarise : pending repeats of the entry, if any, are reported. Call without holding the lock */
+func summarise(e *seenEntry, repeats int) {
+	if repeats > 0 && e.onRepeat != nil {
+		e.onRepeat(repeats, e.since)
+	}
+}
+
+/*
+	Admit : true when the notification is to be sent, false when its a repeat within the window.
+
+key		: identifies the stream of notifications, typically device id and type of notification
+content	: rendered notification that is fingerprinted
+onRepeat	: called if this notification is repeated and the repeats are then summarised
+*/
+func (s *Suppressor) Admit(key, content string, onRepeat OnRepeat) bool {
+	fp := fingerprint(content)
+	s.mu.Lock()
+	e, ok := s.seen[key]
+	if ok && e.fingerprint == fp {
+		e.repeats++
+		e.onRepeat = onRepeat
+		s.mu.Unlock()
+		return false
+	}
+	var prev *seenEntry
+	prevRepeats := 0
+	if ok {
+		// content changed, the window for the previous content closes now
+		e.timer.Stop()
+		prev, prevRepeats = e, e.repeats
+	}
+	e = &seenEntry{fingerprint: fp, since: time.Now(), onRepeat: onRepeat}
+	e.timer = time.AfterFunc(s.window, func() { s.close(key, e) })
+	s.seen[key] = e
+	s.mu.Unlock()
+	if prev != nil {
+		summarise(prev, prevRepeats)
+	}
+	return true
+}
+
+/* close : window for the entry is over, repeats if any are summarised */
+func (s *Suppressor) close(key string, e *seenEntry) {
+	s.mu.Lock()
+	if s.seen[key] != e {
+		s.mu.Unlock()
+		return // entry was replaced in the meantime
+	}
+	delete(s.seen, key)
+	repeats := e.repeats
+	s.mu.Unlock()
+	summarise(e, repeats)
+}
+
+/* Forget : drops the entry without any summary, typically when the admitted notification could not be sent */
+func (s *Suppressor) Forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.seen[key]; ok {
+		e.timer.Stop()
+		delete(s.seen, key)
+	}
+}
+
+/* Flush : closes all the windows, pending repeats are summarised. Typically when shutting down */
+func (s *Suppressor) Flush() {
+	s.mu.Lock()
+	pending := map[*seenEntry]int{}
+	for key, e := range s.seen {
+		e.timer.Stop()
+		pending[e] = e.repeats
+		delete(s.seen, key)
+	}
+	s.mu.Unlock()
+	for e, repeats := range pending {
+		summarise(e, repeats)
+	}
+}
@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// repeatLog : records the summaries as reported by the suppressor
+type repeatLog struct {
+	mu      sync.Mutex
+	repeats []int
+}
+
+func (rl *repeatLog) onRepeat(repeats int, since time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.repeats = append(rl.repeats, repeats)
+}
+
+func (rl *repeatLog) summaries() []int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return append([]int{}, rl.repeats...)
+}
+
+func TestSuppressor(t *testing.T) {
+	key := "b8:27:eb:a5:be:48/gpiostat"
+	t.Run("window_closes", func(t *testing.T) {
+		rl := &repeatLog{}
+		s := NewSuppressor(50 * time.Millisecond)
+		assert.True(t, s.Admit(key, "Pump relay-I: HIGH", rl.onRepeat), "First notification was expected to be sent")
+		for i := 0; i < 3; i++ {
+			assert.False(t, s.Admit(key, "Pump relay-I: HIGH", rl.onRepeat), "Repeat was expected to be suppressed")
+		}
+		assert.True(t, s.Admit("b8:27:eb:a5:be:48/vitals", "Pump relay-I: HIGH", rl.onRepeat), "Other types of notification are not repeats")
+		assert.Eventually(t, func() bool { return len(rl.summaries()) == 1 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, []int{3}, rl.summaries(), "Summary was expected when the window closes")
+		assert.True(t, s.Admit(key, "Pump relay-I: HIGH", rl.onRepeat), "After the window, notification was expected to be sent")
+	})
+	t.Run("content_changes", func(t *testing.T) {
+		rl := &repeatLog{}
+		s := NewSuppressor(time.Hour)
+		assert.True(t, s.Admit(key, "Pump relay-I: HIGH", rl.onRepeat))
+		assert.False(t, s.Admit(key, "Pump relay-I: HIGH", rl.onRepeat))
+		assert.True(t, s.Admit(key, "Pump relay-I: LOW", rl.onRepeat), "Changed content was expected to be sent")
+		assert.Equal(t, []int{1}, rl.summaries(), "Summary was expected when the content changes")
+		s.Flush()
+		assert.Equal(t, []int{1}, rl.summaries(), "No summary was expected without repeats")
+	})
+}
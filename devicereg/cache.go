@@ -0,0 +1,90 @@
+package devicereg
+
+/* In-memory cache of the device registry lookups, so that devicereg is not on the hot path of every notification.
+Unknown devices are cached too (for a shorter while) and when the registry is unreachable expired entries are served */
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	/*
+		NewCache : caches lookups on the source
+		src		: the registry that is looked up on a miss
+		ttl		: time for which a registered device is cached
+		negTtl	: time for which an unknown device is cached */
+	NewCache = func(src Registry, ttl, negTtl time.Duration) *Cache {
+		return &Cache{
+			src:     src,
+			ttl:     ttl,
+			negTtl:  negTtl,
+			entries: map[string]*cacheEntry{},
+		}
+	}
+)
+
+type cacheEntry struct {
+	device  *Device // nil when the device isnt registered
+	expires time.Time
+}
+
+type Cache struct {
+	src     Registry
+	ttl     time.Duration
+	negTtl  time.Duration
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+/* Device : from the cache if fresh, else from the source. Stale entry is served when the source fails */
+func (c *Cache) Device(devid string) (*Device, error) {
+	c.mu.Lock()
+	e, ok := c.entries[devid]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		if e.device == nil {
+			return nil, ErrDeviceNotFound
+		}
+		return e.device, nil
+	}
+	d, err := c.src.Device(devid)
+	if errors.Is(err, ErrDeviceNotFound) {
+		c.mu.Lock()
+		c.entries[devid] = &cacheEntry{expires: time.Now().Add(c.negTtl)}
+		c.mu.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		if ok && e.device != nil {
+			log.WithFields(log.Fields{
+				"devid": devid,
+				"err":   err,
+			}).Warn("Device registry unreachable, serving expired entry")
+			return e.device, nil
+		}
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[devid] = &cacheEntry{device: d, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return d, nil
+}
+
+/* Invalidate : drops the device from the cache, next lookup is from the source */
+func (c *Cache) Invalidate(devid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, devid)
+}
+
+/* Flush : drops all the devices from the cache, count of entries dropped is returned */
+func (c *Cache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := len(c.entries)
+	c.entries = map[string]*cacheEntry{}
+	return count
+}
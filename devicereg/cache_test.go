@@ -0,0 +1,58 @@
+package devicereg
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry : registry in memory with a count of lookups, can be made unreachable
+type fakeRegistry struct {
+	*MemRegistry
+	down    bool
+	lookups int
+}
+
+func (fr *fakeRegistry) Device(devid string) (*Device, error) {
+	fr.lookups++
+	if fr.down {
+		return nil, fmt.Errorf("failed request to get device details: connection refused")
+	}
+	return fr.MemRegistry.Device(devid)
+}
+
+func TestCache(t *testing.T) {
+	src := &fakeRegistry{MemRegistry: NewMemRegistry(&Device{ID: "b8:27:eb:a5:be:48", ChatIDs: []string{"-100"}})}
+	c := NewCache(src, 50*time.Millisecond, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		d, err := c.Device("b8:27:eb:a5:be:48")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"-100"}, d.ChatIDs)
+	}
+	assert.Equal(t, 1, src.lookups, "Repeat lookups were expected from the cache")
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Device("b8:27:eb:00:00:00")
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+	}
+	assert.Equal(t, 2, src.lookups, "Unknown device was expected to be cached")
+
+	time.Sleep(60 * time.Millisecond)
+	src.down = true
+	d, err := c.Device("b8:27:eb:a5:be:48")
+	assert.Nil(t, err, "Expired entry was expected when the registry is down")
+	assert.Equal(t, []string{"-100"}, d.ChatIDs)
+	_, err = c.Device("b8:27:eb:00:00:00")
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrDeviceNotFound, "Unknown device is not served when expired")
+
+	src.down = false
+	src.Put(&Device{ID: "b8:27:eb:a5:be:48", ChatIDs: []string{"-200"}})
+	c.Invalidate("b8:27:eb:a5:be:48")
+	d, _ = c.Device("b8:27:eb:a5:be:48")
+	assert.Equal(t, []string{"-200"}, d.ChatIDs, "Invalidated device was expected from the registry")
+	assert.Equal(t, 2, c.Flush())
+}
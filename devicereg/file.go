@@ -0,0 +1,53 @@
+package devicereg
+
+/* Registry from a static file, for small deployments that dont run devicereg.
+File is yaml or json as per the extension, and is read once when opened
+
+devices:
+  - id: b8:27:eb:a5:be:48
+    name: Aquaponics pump control-I, Saidham
+    mac: b8:27:eb:a5:be:48
+    chat_ids: ["-1002033658371"]
+    timezone: Asia/Kolkata
+*/
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	/*
+		OpenFileRegistry : reads all the devices from the file
+		path : .yaml, .yml or .json file */
+	OpenFileRegistry = func(path string) (*MemRegistry, error) {
+		byt, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read registry file %s", err)
+		}
+		result := struct {
+			Devices []*Device `json:"devices" yaml:"devices"`
+		}{}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(byt, &result)
+		case ".json":
+			err = json.Unmarshal(byt, &result)
+		default:
+			return nil, fmt.Errorf("unsupported registry file %s, expected yaml or json", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read devices from registry file %s", err)
+		}
+		for i, d := range result.Devices {
+			if d.ID == "" {
+				return nil, fmt.Errorf("device at %d in registry file has no id", i)
+			}
+		}
+		return NewMemRegistry(result.Devices...), nil
+	}
+)
@@ -0,0 +1,34 @@
+package devicereg
+
+import (
+	"errors"
+
+	"github.com/eensymachines-in/webpi-telegnotify/breaker"
+)
+
+var (
+	/*
+		NewGuardedRegistry : registry behind a circuit breaker, when open lookups fail fast with breaker.ErrOpen
+		Unknown devices are not failures, the registry did respond */
+	NewGuardedRegistry = func(reg Registry, b *breaker.Breaker) *GuardedRegistry {
+		return &GuardedRegistry{reg: reg, brk: b}
+	}
+)
+
+type GuardedRegistry struct {
+	reg Registry
+	brk *breaker.Breaker
+}
+
+func (gr *GuardedRegistry) Device(devid string) (*Device, error) {
+	if err := gr.brk.Allow(); err != nil {
+		return nil, err
+	}
+	d, err := gr.reg.Device(devid)
+	if err != nil && !errors.Is(err, ErrDeviceNotFound) {
+		gr.brk.Failure()
+		return nil, err
+	}
+	gr.brk.Success()
+	return d, err
+}
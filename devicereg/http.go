@@ -0,0 +1,83 @@
+package devicereg
+
+/* Lookups on the devicereg u-service */
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	/*
+		NewHttpRegistry : registry on the devicereg u-service
+		baseurl	: ex: http://aqua.eensymachines.in:30001/api/devices
+		timeout	: http client timeout for each of the requests */
+	NewHttpRegistry = func(baseurl string, timeout time.Duration) *HttpRegistry {
+		return &HttpRegistry{
+			BaseURL: strings.TrimSuffix(baseurl, "/"),
+			Client:  &http.Client{Timeout: timeout},
+		}
+	}
+)
+
+type HttpRegistry struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// httpDevice : device as sent by devicereg, telggrpid is the group the device registers when booting up the first time
+type httpDevice struct {
+	Name     string   `json:"name"`
+	Mac      string   `json:"mac"`
+	GrpID    string   `json:"telggrpid"`
+	GrpIDs   []string `json:"telggrpids"` // additional groups if any
+	Timezone string   `json:"timezone"`
+	Owner    string   `json:"owner"`
+	Muted    bool     `json:"muted"`
+}
+
+/* Device : device as registered on devicereg, 404 from devicereg is ErrDeviceNotFound */
+func (hr *HttpRegistry) Device(devid string) (*Device, error) {
+	url := fmt.Sprintf("%s/%s", hr.BaseURL, devid)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to form new http request, check url and then try again %s", err)
+	}
+	resp, err := hr.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed request to get device details %s", err)
+	}
+	defer resp.Body.Close()
+	byt, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body %s", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrDeviceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("devicereg responded with status %d", resp.StatusCode)
+	}
+	result := httpDevice{}
+	if err := json.Unmarshal(byt, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshalling response body %s", err)
+	}
+	d := &Device{
+		ID:       devid,
+		Name:     result.Name,
+		Mac:      result.Mac,
+		ChatIDs:  []string{},
+		Timezone: result.Timezone,
+		Owner:    result.Owner,
+		Muted:    result.Muted,
+	}
+	for _, id := range append([]string{result.GrpID}, result.GrpIDs...) {
+		if id != "" {
+			d.ChatIDs = append(d.ChatIDs, id)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,70 @@
+package devicereg
+
+/* Device registry, to know the details of the device and specifically the telegram groups its notifications are posted to.
+Registry can be the devicereg u-service over http, a static yaml/json file for small deployments or in memory for tests */
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrDeviceNotFound = fmt.Errorf("device is not registered")
+)
+
+var (
+	/*
+		NewMemRegistry : registry in memory, typically for tests
+		devices : devices registered to start with */
+	NewMemRegistry = func(devices ...*Device) *MemRegistry {
+		mr := &MemRegistry{devices: map[string]*Device{}}
+		for _, d := range devices {
+			mr.Put(d)
+		}
+		return mr
+	}
+)
+
+// Device : device as registered
+type Device struct {
+	ID       string   `json:"id" yaml:"id"`             // device id as in the url, typically the mac id
+	Name     string   `json:"name" yaml:"name"`         // name of the device ex: Aquaponics pump control-I, Saidham
+	Mac      string   `json:"mac" yaml:"mac"`           // mac id of the device
+	ChatIDs  []string `json:"chat_ids" yaml:"chat_ids"` // telegram groups the notifications are posted to
+	Timezone string   `json:"timezone" yaml:"timezone"` // IANA timezone of the device ex: Asia/Kolkata
+	Owner    string   `json:"owner" yaml:"owner"`       // person or organisation owning the device
+	Muted    bool     `json:"muted" yaml:"muted"`       // notifications from muted devices are accepted but not sent
+}
+
+// Registry : anything that can get the device details
+type Registry interface {
+	Device(devid string) (*Device, error) // ErrDeviceNotFound when the device isnt registered
+}
+
+type MemRegistry struct {
+	mu      sync.RWMutex
+	devices map[string]*Device
+}
+
+func (mr *MemRegistry) Device(devid string) (*Device, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	d, ok := mr.devices[devid]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+	return d, nil
+}
+
+/* Put : registers the device, replaces if already registered */
+func (mr *MemRegistry) Put(d *Device) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.devices[d.ID] = d
+}
+
+/* Remove : device is no longer registered */
+func (mr *MemRegistry) Remove(devid string) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	delete(mr.devices, devid)
+}
@@ -0,0 +1,68 @@
+package devicereg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpRegistry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/devices/b8:27:eb:a5:be:48":
+			w.Write([]byte(`{"name":"Aquaponics pump control-I, Saidham","mac":"b8:27:eb:a5:be:48","telggrpid":"-100","timezone":"Asia/Kolkata"}`))
+		case "/api/devices/b8:27:eb:00:00:01":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	hr := NewHttpRegistry(srv.URL+"/api/devices/", time.Second)
+	d, err := hr.Device("b8:27:eb:a5:be:48")
+	assert.Nil(t, err)
+	assert.Equal(t, "Aquaponics pump control-I, Saidham", d.Name)
+	assert.Equal(t, []string{"-100"}, d.ChatIDs)
+	assert.Equal(t, "Asia/Kolkata", d.Timezone)
+	_, err = hr.Device("b8:27:eb:00:00:00")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	_, err = hr.Device("b8:27:eb:00:00:01")
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrDeviceNotFound, "Server errors are not unknown devices")
+}
+
+func TestFileRegistry(t *testing.T) {
+	dir := t.TempDir()
+	data := map[string]string{
+		"devices.yaml": `devices:
+  - id: b8:27:eb:a5:be:48
+    name: Aquaponics pump control-I, Saidham
+    mac: b8:27:eb:a5:be:48
+    chat_ids: ["-100", "-200"]
+    timezone: Asia/Kolkata
+    muted: true
+`,
+		"devices.json": `{"devices":[{"id":"b8:27:eb:a5:be:48","name":"Aquaponics pump control-I, Saidham","mac":"b8:27:eb:a5:be:48","chat_ids":["-100","-200"],"timezone":"Asia/Kolkata","muted":true}]}`,
+	}
+	for name, content := range data {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+			reg, err := OpenFileRegistry(path)
+			assert.Nil(t, err)
+			d, err := reg.Device("b8:27:eb:a5:be:48")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"-100", "-200"}, d.ChatIDs)
+			assert.True(t, d.Muted)
+			_, err = reg.Device("b8:27:eb:00:00:00")
+			assert.ErrorIs(t, err, ErrDeviceNotFound)
+		})
+	}
+	_, err := OpenFileRegistry(filepath.Join(dir, "devices.toml"))
+	assert.NotNil(t, err)
+}
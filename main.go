@@ -5,18 +5,28 @@ package main
 2. Status of GPIO and thus the actuators and sensors connected to it
 3. Vital stats of the device - status of the services, temp, cpu usage percentage  */
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // device timezones are loaded by name, the image may not have the zoneinfo
 
 	"github.com/eensymachines-in/errx/httperr"
-	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/eensymachines-in/webpi-telegnotify/breaker"
+	"github.com/eensymachines-in/webpi-telegnotify/delivery"
+	"github.com/eensymachines-in/webpi-telegnotify/devicereg"
 	"github.com/eensymachines-in/webpi-telegnotify/models"
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
@@ -24,17 +34,57 @@ import (
 var (
 	/* this is to be populated from the environment*/
 	environVars = []string{
-		"DEVICEREG_URL",
 		"BOT_BASEURL",
 		"BOT_TOK",
 		"BOT_UNAME",
 	}
 )
 
-type BotMessage struct {
-	ChatID    string `json:"chat_id"`
-	Txt       string `json:"text"`
-	ParseMode string `json:"parse_mode"` // markdown or html - message then can be parse accordigly
+var (
+	queue       *delivery.Queue              // notifications are queued here and then posted to telegram by workers
+	deadLetters delivery.DeadLetters         // notifications that could not be delivered inspite of retries
+	limiter     *delivery.Limiter            // telegram send limits, global and per chat
+	idempotency *delivery.Idempotency        // idempotency keys from the devices, so that retries arent sent again
+	suppressor  *delivery.Suppressor         // repeats of the same notification are suppressed, nil when disabled
+	digest      *delivery.Digest             // notifications combined in a single message at an interval, nil when disabled
+	devices     *devicereg.Cache             // device registry lookups, cached
+	tgBreaker   *breaker.Breaker             // telegram server, when open notifications are parked in the outbox
+	regBreaker  *breaker.Breaker             // devicereg, when open lookups fail fast
+	schemas     = models.NewVersionTracker() // schema versions the devices send, to know which of them are on older firmware
+	pinStates   = models.NewPinTracker()     // last known state of the pins on each device, gpio status is shown as the changes
+
+	fallbackGrpID = os.Getenv("FALLBACK_GRPID") // notifications that cant be routed to the device group are sent here, optional
+	opsGrpID      = os.Getenv("OPS_GRPID")      // internal delivery errors are reported here, optional
+
+	defaultTZ         = time.Local  // timezone for devices that dont have one in the registry
+	clockSkewMax      time.Duration // device clock off by more than this is flagged
+	suppressUnchanged bool          // gpio status with no change in the pins is not sent
+)
+
+/* envOrDefault : reads an optional variable from the environment, when absent falls back on the default */
+func envOrDefault(name, def string) string {
+	if val := os.Getenv(name); val != "" {
+		return val
+	}
+	return def
+}
+
+/* intEnvOrDefault : reads an optional integer from the environment, when absent or unreadable falls back on the default */
+func intEnvOrDefault(name string, def int) int {
+	val, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+/* floatEnvOrDefault : reads an optional decimal number from the environment, when absent or unreadable falls back on the default */
+func floatEnvOrDefault(name string, def float64) float64 {
+	val, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return val
 }
 
 func init() {
@@ -85,87 +135,92 @@ func init() {
 }
 
 /*
-	FetchDeviceDetails : to know the details of device specifically the telegram group to which notifications are to be sent
+	FetchDeviceDetails : to know the details of device specifically the telegram groups to which notifications are to be sent
 
-makes a simple http call to the devicereg u-service, incase the call fails this shall abort any further calls to handlers
-NOTE: for extensions in the future there has to be a fallback group that the notifications should be logged to. Or perhaps we can think of loggging
-all errors in a group , notifications on a grop, logs to a group as well.
+looks up the device registry (cached), incase the lookup fails this shall abort any further calls to handlers
+When the device is unknown, has no group or devicereg is down the notification is sent to the fallback group (if configured)
 */
 func FetchDeviceDetails(c *gin.Context) {
-	cl := &http.Client{
-		Timeout: 3 * time.Second,
+	devid := c.Param("devid")
+	dev, err := devices.Device(devid)
+	if err == nil && len(dev.ChatIDs) == 0 {
+		err = fmt.Errorf("%w: no telegram group for the device", devicereg.ErrDeviceNotFound)
 	}
-	// TODO: somehow we need a well formed url
-	url := fmt.Sprintf("%s/%s", os.Getenv("DEVICEREG_URL"), c.Param("devid"))
-	log.WithFields(log.Fields{
-		"url": url,
-	}).Debug("Url ready")
-	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		err = fmt.Errorf("failed to form new http request, check url and then try again %s", err)
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrGatewayConnect(err), log.WithFields(log.Fields{
-			"stack": "FetchDeviceDetails/NewRequest",
-		}))
-		return
-	}
-	resp, err := cl.Do(req)
-	if err != nil {
-		err = fmt.Errorf("failed request to ge device details %d:%s", resp.StatusCode, err)
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrGatewayConnect(err), log.WithFields(log.Fields{
-			"stack": "FetchDeviceDetails/Do",
-		}))
-		return
-	}
-	log.WithFields(log.Fields{
-		"status_code": resp.StatusCode,
-	}).Debug("Fetched the device details..")
-	byt, err := io.ReadAll(resp.Body)
-	if err != nil {
-		err = fmt.Errorf("error reading response body %s", err)
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrBinding(err), log.WithFields(log.Fields{
-			"stack": "FetchDeviceDetails/io.ReadAll",
-		}))
+		/* Notifications that cannot be routed go to the fallback group if any, with a banner explaining why */
+		if fallbackGrpID != "" {
+			log.WithFields(log.Fields{
+				"devid": devid,
+				"err":   err,
+			}).Warn("Failed to route notification, sending to fallback group")
+			reason := "device registry is unreachable"
+			if errors.Is(err, breaker.ErrOpen) {
+				reason = "device registry is down"
+			} else if errors.Is(err, devicereg.ErrDeviceNotFound) {
+				reason = "device is not registered or has no group"
+			}
+			c.Set("GRP_IDS", []string{fallbackGrpID})
+			c.Set("ROUTE_BANNER", fmt.Sprintf("%c Sent to fallback group: %s", models.EMOJI_warning, reason))
+			c.Next()
+			return
+		}
+		le := log.WithFields(log.Fields{
+			"stack": "FetchDeviceDetails",
+			"devid": devid,
+		})
+		if errors.Is(err, devicereg.ErrDeviceNotFound) {
+			httperr.HttpErrOrOkDispatch(c, httperr.ErrResourceNotFound(err), le)
+		} else if errors.Is(err, breaker.ErrOpen) {
+			le.WithField("err", err).Warn("devicereg breaker open, failing fast")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"err_data": "device registry is down, try again later",
+			})
+		} else {
+			httperr.HttpErrOrOkDispatch(c, httperr.ErrGatewayConnect(err), le)
+		}
 		return
 	}
-	result := struct {
-		GrpID string `json:"telggrpid"`
-	}{}
-	err = json.Unmarshal(byt, &result)
-	if err != nil {
-		err = fmt.Errorf("error unmarshalling response body %s", err)
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrBinding(err), log.WithFields(log.Fields{
-			"stack": "FetchDeviceDetails/json.Unmarshal",
-		}))
+	if dev.Muted {
+		log.WithFields(log.Fields{
+			"devid": devid,
+		}).Debug("Device is muted, notification not sent")
+		c.AbortWithStatusJSON(http.StatusAccepted, gin.H{
+			"muted": true,
+		})
 		return
 	}
 	log.WithFields(log.Fields{
-		"grp_id": result.GrpID,
-	}).Debug("Group id the notification is posted to")
-	c.Set("GRP_ID", result.GrpID)
+		"grp_ids": dev.ChatIDs,
+	}).Debug("Group ids the notification is posted to")
+	c.Set("DEVICE", dev)
+	c.Set("GRP_IDS", dev.ChatIDs)
 	c.Next() // downstream handlers to take care of this
 
 }
-func HndlDeviceNotifics(c *gin.Context) {
-	typOfNotify := c.Query("typ")
-	var not models.DeviceNotifcn
-	/* Figuring out the type of notificaiton and making the object accordingly*/
-	if typOfNotify == "" {
-		// incase when the hhandler does not know the query params to determine which type of notification
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrContxParamMissing(fmt.Errorf("not enough query params in the request")), log.WithFields(log.Fields{
-			"typ": typOfNotify,
-		}))
-		return
-	} else if typOfNotify == "cfgchange" {
-		log.Debug("Notifying a configuration change")
-		not = models.Notification("", "", time.Now(), models.CfgChange(&aquacfg.Schedule{})) // onto which the payload would be unmarshalled
 
-	} else if typOfNotify == "gpiostat" {
-		log.Debug("Gpio status notification")
-		not = models.Notification("", "", time.Now(), models.GpioStatus(&models.Pinstat{})) // onto which the payload would be unmarshalled
-	} else if typOfNotify == "vitals" {
-		log.Debug("Vitals status notification")
-		not = models.Notification("", "", time.Now(), models.VitalStats("", "", "", "", "")) // onto which the payload would be unmarshalled
+/* deviceLocation : timezone of the device as in the registry, default timezone if it has none or the device is unknown */
+func deviceLocation(c *gin.Context) *time.Location {
+	val, ok := c.Get("DEVICE")
+	if !ok {
+		return defaultTZ
 	}
+	dev, ok := val.(*devicereg.Device)
+	if !ok || dev.Timezone == "" {
+		return defaultTZ
+	}
+	loc, err := time.LoadLocation(dev.Timezone)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"devid":    dev.ID,
+			"timezone": dev.Timezone,
+			"err":      err,
+		}).Warn("Unknown timezone for device, using default")
+		return defaultTZ
+	}
+	return loc
+}
+
+func HndlDeviceNotifics(c *gin.Context) {
 	/* Reading the request body and that is agnostic of which notification it is */
 	byt, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -174,46 +229,281 @@ func HndlDeviceNotifics(c *gin.Context) {
 		}))
 		return
 	}
-	err = json.Unmarshal(byt, &not)
+	/* Kind of notification is as the body says, older devices send it only in the query as ?typ= */
+	not, err := models.ParseNotification(byt, c.Query("typ"))
 	if err != nil {
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrBinding(err), log.WithFields(log.Fields{
+		le := log.WithFields(log.Fields{
 			"stack": "HndlDeviceNotifics",
-		}))
+			"typ":   c.Query("typ"),
+			"kinds": models.Kinds(),
+		})
+		if errors.Is(err, models.ErrUnknownKind) || errors.Is(err, models.ErrKindMismatch) || errors.Is(err, models.ErrUnsupportedVersion) {
+			httperr.HttpErrOrOkDispatch(c, httperr.ErrValidation(err), le)
+		} else {
+			httperr.HttpErrOrOkDispatch(c, httperr.ErrBinding(err), le)
+		}
+		return
+	}
+	kind := not.Kind()
+	typOfNotify := kind.Name
+	/* Each of the offending fields is reported back, so that the firmware can be fixed in one go */
+	if err := models.Validate(not, c.Param("devid")); err != nil {
+		log.WithFields(log.Fields{
+			"stack": "HndlDeviceNotifics",
+			"devid": c.Param("devid"),
+			"typ":   typOfNotify,
+			"err":   err,
+		}).Warn("Invalid notification from device")
+		fields := models.FieldErrors{}
+		errors.As(err, &fields)
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"err_data": "One or more fields of the notification are invalid",
+			"fields":   fields,
+		})
 		return
 	}
+	if sent := not.SentVersion(); sent < not.Kind().Version {
+		log.WithFields(log.Fields{
+			"devid":   c.Param("devid"),
+			"typ":     typOfNotify,
+			"version": sent,
+		}).Debug("Notification upgraded from an older schema version")
+	}
+	schemas.Seen(c.Param("devid"), kind, not.SentVersion())
+	/* Dates are rendered in the device timezone, and the device clock is checked against the time of receipt */
+	loc := deviceLocation(c)
+	not.SetLocation(loc)
+	skew := not.ClockSkew()
+	if skew > clockSkewMax || skew < -clockSkewMax {
+		log.WithFields(log.Fields{
+			"devid": c.Param("devid"),
+			"skew":  skew,
+		}).Warn("Device clock is off")
+	}
+	/* Payload is kept as parsed, so that the type and version travel along with it in the outbox and dead letters */
+	if normalized, err := json.Marshal(not); err == nil {
+		byt = normalized
+	}
+	/* Retries from the device carry the same idempotency key, the original result is sent back for those */
+	devid := c.Param("devid")
+	idemKey := c.GetHeader("Idempotency-Key")
+	if idemKey == "" {
+		idemKey = not.ID()
+	}
+	if idemKey != "" {
+		if res, claimed := idempotency.Claim(devid, idemKey); !claimed {
+			log.WithFields(log.Fields{
+				"devid": devid,
+				"key":   idemKey,
+			}).Warn("Repeat notification, not sent again")
+			if res == nil {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"err_data": "Notification with the same key is being processed, try again after some time",
+				})
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.AbortWithStatusJSON(res.Status, res.Body)
+			return
+		}
+	}
+	/* accepted : response to the device once the notification is taken care of, retries with the same key get the same */
+	accepted := func(result gin.H) {
+		if skew > clockSkewMax || skew < -clockSkewMax {
+			result["clock_skew_secs"] = int(skew.Seconds()) // device can correct its clock
+		}
+		if idemKey != "" {
+			idempotency.Remember(devid, idemKey, &delivery.Result{Status: http.StatusAccepted, Body: result})
+		}
+		c.AbortWithStatusJSON(http.StatusAccepted, result)
+	}
+	/* GPIO status is shown as the pins that changed since the last known state, ?full=true for all the pins */
+	var pinSnap *models.PinSnapshot
+	if pt, ok := not.Specific().(models.PinTracked); ok {
+		var changed bool
+		if pinSnap, changed = pt.Track(pinStates, devid, c.Query("full") == "true"); !changed && suppressUnchanged {
+			log.WithFields(log.Fields{
+				"devid": devid,
+			}).Debug("No change in the pins, not sent")
+			accepted(gin.H{"unchanged": true})
+			return
+		}
+	}
 	/* Preparing the notification to be sent across to telegram */
 	msg, _ := not.ToMessageTxt()
 	log.WithFields(log.Fields{
 		"msg_txt": msg,
 	}).Debug("Notification message text")
-	grpId, _ := c.Get("GRP_ID") // from the previous handler we have the telegram grp id that we need to post the notification to
-	bm := BotMessage{ChatID: grpId.(string), Txt: msg, ParseMode: "markdown"}
-	byt, _ = json.Marshal(bm)
-	url := fmt.Sprintf("%s%s/sendMessage", os.Getenv("BOT_BASEURL"), os.Getenv("BOT_TOK"))
-	log.WithFields(log.Fields{
-		"telegram_url": url,
-	}).Debug("Telegram post url ready..")
-
-	/* Sending the notificaiton  */
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(byt))
-	if err != nil {
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrGatewayConnect(fmt.Errorf("failed to form new post request %s", err)), log.WithFields(log.Fields{
-			"stack": "HndlDeviceNotifics/typ=cfgchange",
-		}))
+	header := not.ToHeaderTxt()
+	if banner := c.GetString("ROUTE_BANNER"); banner != "" {
+		// notification that couldnt be routed, the fallback group gets to know why
+		msg = fmt.Sprintf("%s\n%s", banner, msg)
+		header = fmt.Sprintf("%s\n%s", banner, header)
+	}
+	/* Groups in digest mode get their notifications in a combined message at an interval, rest of them directly */
+	chatIDs := c.GetStringSlice("GRP_IDS") // from the previous handler we have the telegram grp ids that we need to post the notification to
+	direct := []string{}
+	digested := false
+	/* Some notifications decide for themselves if they are heard, or if they can wait for the digest */
+	silent, urgent := false, false
+	if a, ok := not.Specific().(models.Audible); ok {
+		silent = a.Silent()
+	}
+	if u, ok := not.Specific().(models.Urgent); ok {
+		urgent = u.Urgent()
+	}
+	for _, chatID := range chatIDs {
+		if !urgent && digest != nil && digest.Covers(chatID, devid) {
+			txt, _ := not.Specific().ToMessageTxt()
+			if pt, ok := not.Specific().(models.PinTracked); ok {
+				// digest keeps only the latest status of the device, changes since the report before would lose those in between
+				txt, _ = pt.ToFullTxt()
+			}
+			err := digest.Add(chatID, delivery.DigestItem{
+				DevID:  devid,
+				Header: header,
+				Typ:    typOfNotify,
+				Txt:    txt,
+				At:     time.Now().In(loc),
+				Event:  kind.Event,
+			})
+			if err == nil {
+				digested = true
+				continue
+			}
+			// not persisted for the digest, sent directly instead so that it is not lost
+			log.WithFields(log.Fields{
+				"stack":   "HndlDeviceNotifics/Digest",
+				"chat_id": chatID,
+				"err":     err,
+			}).Error("failed to collect notification for digest")
+		}
+		direct = append(direct, chatID)
+	}
+	if len(direct) == 0 {
+		accepted(gin.H{"digest": true})
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	cl := &http.Client{Timeout: 5 * time.Second}
-	resp, err := cl.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		httperr.HttpErrOrOkDispatch(c, httperr.ErrGatewayConnect(fmt.Errorf("failed to post notification message to telegram server %s", err)), log.WithFields(log.Fields{
-			"stack": "HndlDeviceNotifics/typ=cfgchange",
-		}))
+	/* Same content repeated by the device is suppressed for a window, and the repeats are then summarised. Urgent ones are always sent */
+	suppressKey := fmt.Sprintf("%s/%s", devid, typOfNotify)
+	suppressed := suppressor != nil && !urgent
+	if suppressed {
+		content, _ := not.Specific().ToMessageTxt()
+		admitted := suppressor.Admit(suppressKey, content, func(repeats int, since time.Time) {
+			txt, _ := not.ToRepeatedTxt(repeats, since)
+			for _, chatID := range direct {
+				job := delivery.NewJob(devid, typOfNotify, byt, telegram.BotMessage{ChatID: chatID, Txt: txt, ParseMode: "markdown", DisableNotification: silent})
+				if err := queue.Enqueue(job); err != nil {
+					log.WithFields(log.Fields{
+						"stack":   "HndlDeviceNotifics/Suppressor",
+						"devid":   devid,
+						"chat_id": chatID,
+						"repeats": repeats,
+						"err":     err,
+					}).Error("failed to queue summary of repeats")
+				}
+			}
+		})
+		if !admitted {
+			log.WithFields(log.Fields{
+				"devid": devid,
+				"typ":   typOfNotify,
+			}).Debug("Repeat notification suppressed")
+			accepted(gin.H{"suppressed": true, "digest": digested})
+			return
+		}
+	}
+	/* Queuing the notification for each of the groups, workers shall post this to telegram  */
+	deliveryIDs := []string{}
+	for _, chatID := range direct {
+		job := delivery.NewJob(devid, typOfNotify, byt, telegram.BotMessage{ChatID: chatID, Txt: msg, ParseMode: "markdown", DisableNotification: silent})
+		if err := queue.Enqueue(job); err != nil {
+			log.WithFields(log.Fields{
+				"stack":   "HndlDeviceNotifics/Enqueue",
+				"chat_id": chatID,
+				"err":     err,
+			}).Error("failed to queue notification")
+			continue
+		}
+		deliveryIDs = append(deliveryIDs, job.ID)
+	}
+	if len(deliveryIDs) == 0 && !digested {
+		// nothing was queued, device is expected to retry
+		if idemKey != "" {
+			idempotency.Forget(devid, idemKey)
+		}
+		if suppressed {
+			suppressor.Forget(suppressKey) // retry is then not a repeat
+		}
+		if pinSnap != nil {
+			pinStates.Revert(devid, pinSnap) // retry is then diffed against the state before
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"err_data": "Server is too busy to accept notifications, try again after some time",
+		})
 		return
 	}
-	log.Debug("Telegram message posted..")
-	c.AbortWithStatusJSON(http.StatusOK, gin.H{})
+	log.WithFields(log.Fields{
+		"delivery_ids": deliveryIDs,
+	}).Debug("Notification queued..")
+	result := gin.H{
+		"delivery_ids": deliveryIDs,
+		"digest":       digested,
+	}
+	if len(deliveryIDs) > 0 {
+		result["delivery_id"] = deliveryIDs[0]
+	}
+	accepted(result)
+}
+
+/*
+	openRegistry : device registry as configured from the environment
+
+DEVICEREG=http	: devicereg u-service at DEVICEREG_URL, default
+DEVICEREG=file	: yaml/json file at DEVICEREG_FILE
+DEVICEREG=mem	: empty registry in memory, all notifications then go to the fallback group
+*/
+func openRegistry() (devicereg.Registry, error) {
+	switch typ := envOrDefault("DEVICEREG", "http"); typ {
+	case "http":
+		if os.Getenv("DEVICEREG_URL") == "" {
+			return nil, fmt.Errorf("missing environment variable : DEVICEREG_URL")
+		}
+		return devicereg.NewHttpRegistry(os.Getenv("DEVICEREG_URL"), 3*time.Second), nil
+	case "file":
+		return devicereg.OpenFileRegistry(os.Getenv("DEVICEREG_FILE"))
+	case "mem":
+		return devicereg.NewMemRegistry(), nil
+	default:
+		return nil, fmt.Errorf("unknown device registry %s, expected http, file or mem", typ)
+	}
 }
+
+/* reportToOps : notification that could not be delivered is reported on the ops group. Plain text, since errors can have markdown characters */
+func reportToOps(j *delivery.Job) {
+	if j.Msg.ChatID == opsGrpID {
+		return // failing to report on the ops group isnt reported again
+	}
+	txt := fmt.Sprintf("%c Failed to deliver notification\nDelivery: %s\nDevice: %s\nType: %s\nChat: %s\nAttempts: %d\nError: %s", models.EMOJI_redcross, j.ID, j.DevID, j.Typ, j.Msg.ChatID, j.Attempts, j.LastErr)
+	job := delivery.NewJob(j.DevID, "ops", nil, telegram.BotMessage{ChatID: opsGrpID, Txt: txt})
+	if err := queue.Enqueue(job); err != nil {
+		log.WithFields(log.Fields{
+			"stack": "reportToOps",
+			"id":    j.ID,
+			"err":   err,
+		}).Error("failed to queue report to ops group")
+	}
+}
+
+/* durationEnvOrDefault : reads an optional duration (ex: 1s, 15m) from the environment, when absent or unreadable falls back on the default */
+func durationEnvOrDefault(name string, def time.Duration) time.Duration {
+	val, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
 func main() {
 	log.Info("Starting webapi devicenotification..")
 	defer log.Warn("closing the webapi application")
@@ -226,15 +516,133 @@ func main() {
 			"msg": "If you can read this message then the teleg notificaiton server is running",
 		})
 	})
+	/* Health of the upstream dependencies, degraded when any of the breakers is not closed */
+	r.GET("/health", HndlHealth)
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 	// the device to telegram group notiifcation is stored on the devicereg database
 	// the device registers the same when booting up thhe first time  ..
 	notifics := r.Group("/api/devices/:devid/notifications")
 	/*
 		?typ=cfgchange : if the device would want to notify the change in the configuration
-		?typ=gpiostat : if the device wants to report the current state of the GPI
+		?typ=gpiostat : if the device wants to report the current state of the GPI, shown as the pins that changed, &full=true for all the pins
 		?typ=vitals : deivce uses this to notify vital stats
+		?typ=alarm : device raises an alert, info/warning/critical
+		?typ=readings : sensor readings with units and bounds - water temp, pH, humidity, tank level
+		?typ=boot|shutdown|update|reconnect : lifecycle of the device
+		Newer devices send the type in the body instead, {"type":"vitals","schema_version":2,...}
 	*/
 	notifics.POST("", FetchDeviceDetails, HndlDeviceNotifics)
 
-	log.Fatal(r.Run(":8080"))
+	/* Administering the notifications that could not be delivered */
+	admin := r.Group("/api/admin")
+	deadltrs := admin.Group("/deadletters")
+	deadltrs.GET("", HndlDeadLetters)
+	deadltrs.GET("/:id", HndlDeadLetter)
+	deadltrs.POST("/replay", HndlReplayDeadLetters)
+	deadltrs.POST("/:id/replay", HndlReplayDeadLetter)
+	deadltrs.DELETE("", HndlDiscardDeadLetters)
+	deadltrs.DELETE("/:id", HndlDiscardDeadLetter)
+	admin.GET("/ratelimits", HndlRateLimits)
+	admin.GET("/schemas", HndlSchemaVersions)
+	admin.GET("/pins", HndlPinStates)
+	admin.GET("/pins/:devid", HndlDevicePins)
+	admin.DELETE("/devicereg/cache", HndlFlushDeviceCache)
+	admin.DELETE("/devicereg/cache/:devid", HndlInvalidateDevice)
+
+	/* Dates from the devices are in their timezone, devices that have none in the registry are taken to be in the default */
+	if tz := os.Getenv("DEFAULT_TZ"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatalf("invalid DEFAULT_TZ %s", err)
+		}
+		defaultTZ = loc
+	}
+	clockSkewMax = durationEnvOrDefault("CLOCK_SKEW_MAX", 2*time.Minute)
+	suppressUnchanged = envOrDefault("GPIO_SUPPRESS_UNCHANGED", "false") == "true"
+	/* Vitals over these are flagged in the messages */
+	models.Thresholds.SoCTemp = floatEnvOrDefault("VITALS_SOCTEMP_MAX", models.Thresholds.SoCTemp)
+	models.Thresholds.MemPct = floatEnvOrDefault("VITALS_MEM_MAX", models.Thresholds.MemPct)
+	models.Thresholds.SwapPct = floatEnvOrDefault("VITALS_SWAP_MAX", models.Thresholds.SwapPct)
+	models.Thresholds.DiskPct = floatEnvOrDefault("VITALS_DISK_MAX", models.Thresholds.DiskPct)
+	models.Thresholds.Load = floatEnvOrDefault("VITALS_LOAD_MAX", models.Thresholds.Load)
+	models.Thresholds.WifiRSSI = intEnvOrDefault("VITALS_WIFI_RSSI_MIN", models.Thresholds.WifiRSSI)
+	/* Circuit breakers around devicereg and telegram, so that requests fail fast when either is down */
+	threshold, cooldown := intEnvOrDefault("BREAKER_THRESHOLD", 5), durationEnvOrDefault("BREAKER_COOLDOWN", 30*time.Second)
+	tgBreaker = breaker.NewBreaker("telegram", threshold, cooldown)
+	regBreaker = breaker.NewBreaker("devicereg", threshold, cooldown)
+	expvar.Publish("breakers", expvar.Func(func() interface{} {
+		return []breaker.Stats{tgBreaker.Stats(), regBreaker.Stats()}
+	}))
+	/* Device registry lookups are cached, unknown devices for a shorter while */
+	registry, err := openRegistry()
+	if err != nil {
+		log.Fatal(err)
+	}
+	devices = devicereg.NewCache(devicereg.NewGuardedRegistry(registry, regBreaker), durationEnvOrDefault("DEVICEREG_TTL", 5*time.Minute), durationEnvOrDefault("DEVICEREG_NEGTTL", time.Minute))
+	/* Outbox and dead letters on a mounted volume, so that accepted notifications survive a restart */
+	store, err := delivery.OpenBoltStore(envOrDefault("OUTBOX_PATH", "/var/lib/eensy/telegnotify/outbox.db"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	deadLetters = store.DeadLetters()
+	/* Delivery queue, depth and number of workers can be tweaked from the environment */
+	queue = delivery.NewQueue(intEnvOrDefault("QUEUE_DEPTH", 100), intEnvOrDefault("QUEUE_WORKERS", 4), telegram.NewBot(os.Getenv("BOT_BASEURL"), os.Getenv("BOT_TOK"), 5*time.Second), store.Outbox(), deadLetters)
+	queue.Retry = delivery.RetryPolicy{
+		MaxAttempts: intEnvOrDefault("SEND_MAXATTEMPTS", delivery.DefaultRetry.MaxAttempts),
+		BaseDelay:   durationEnvOrDefault("SEND_BACKOFF", delivery.DefaultRetry.BaseDelay),
+		MaxDelay:    durationEnvOrDefault("SEND_BACKOFFMAX", delivery.DefaultRetry.MaxDelay),
+	}
+	limiter = delivery.NewLimiter(float64(intEnvOrDefault("RATE_GLOBAL", 30)), float64(intEnvOrDefault("RATE_CHAT", 20)), intEnvOrDefault("RATE_CHATBURST", 3))
+	queue.Limiter = limiter
+	queue.Breaker = tgBreaker
+	if opsGrpID != "" {
+		queue.OnDead = reportToOps
+	}
+	queue.Start()
+	idempotency = delivery.NewIdempotency(durationEnvOrDefault("IDEMPOTENCY_WINDOW", time.Hour))
+	if digestChats, digestDevices := os.Getenv("DIGEST_CHATS"), os.Getenv("DIGEST_DEVICES"); digestChats != "" || digestDevices != "" {
+		digest = delivery.NewDigest(durationEnvOrDefault("DIGEST_INTERVAL", 15*time.Minute), strings.Split(digestChats, ","), strings.Split(digestDevices, ","), store.Digests(), func(chatID, txt string) error {
+			job := delivery.NewJob("", "digest", nil, telegram.BotMessage{ChatID: chatID, Txt: txt, ParseMode: "markdown"})
+			return queue.Enqueue(job)
+		})
+		if err := digest.Restore(); err != nil {
+			log.Error(err)
+		}
+		digest.Start()
+	}
+	/* Suppression of repeats is opt in, off unless a window is set */
+	if window := durationEnvOrDefault("SUPPRESS_WINDOW", 0); window > 0 {
+		suppressor = delivery.NewSuppressor(window)
+	}
+	go func() {
+		if err := queue.Replay(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	/* Waiting on the interruption, and then shutting down gracefully. Queue is drained before exiting  */
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Errorf("failed to shutdown server gracefully %s", err)
+	}
+	if suppressor != nil {
+		suppressor.Flush() // pending summaries of repeats are queued before draining
+	}
+	if digest != nil {
+		digest.Stop() // pending digests are queued before draining
+	}
+	if err := queue.Close(ctx); err != nil {
+		log.Error(err)
+	}
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/delivery"
+	"github.com/eensymachines-in/webpi-telegnotify/devicereg"
+	"github.com/eensymachines-in/webpi-telegnotify/models"
+	"github.com/eensymachines-in/webpi-telegnotify/telegram"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDevID = "b8:27:eb:a5:be:48"
+
+// recordingSender : telegram as far as the handler tests go, records all the messages sent
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []telegram.BotMessage
+}
+
+func (rs *recordingSender) SendMessage(bm *telegram.BotMessage) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.sent = append(rs.sent, *bm)
+	return nil
+}
+
+func (rs *recordingSender) count() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return len(rs.sent)
+}
+
+/*
+	setupHandler : device notification route with the device registry in memory and the queue on a temporary store.
+
+Queue is started only when there are workers, else jobs wait on the queue till it is full
+*/
+func setupHandler(t *testing.T, depth, workers int, chatIDs ...string) (*gin.Engine, *recordingSender) {
+	gin.SetMode(gin.TestMode)
+	st, err := delivery.OpenBoltStore(filepath.Join(t.TempDir(), "outbox.db"))
+	assert.Nil(t, err)
+	snd := &recordingSender{}
+	queue = delivery.NewQueue(depth, workers, snd, st.Outbox(), st.DeadLetters())
+	if workers > 0 {
+		queue.Start()
+	}
+	devices = devicereg.NewCache(devicereg.NewMemRegistry(&devicereg.Device{ID: testDevID, Name: "Sump-I", Mac: testDevID, ChatIDs: chatIDs}), time.Minute, time.Minute)
+	idempotency = delivery.NewIdempotency(time.Hour)
+	pinStates = models.NewPinTracker()
+	clockSkewMax = 2 * time.Minute
+	digest, suppressor = nil, nil
+	t.Cleanup(func() {
+		queue.Close(context.Background())
+		st.Close()
+		digest, suppressor = nil, nil
+	})
+	r := gin.New()
+	r.POST("/api/devices/:devid/notifications", FetchDeviceDetails, HndlDeviceNotifics)
+	return r, snd
+}
+
+/* postNotification : posts the notification for the test device, idempotency key is sent when not empty */
+func postNotification(r *gin.Engine, body, idemKey string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/devices/%s/notifications", testDevID), bytes.NewBufferString(body))
+	if idemKey != "" {
+		req.Header.Set("Idempotency-Key", idemKey)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	result := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
+
+func gpioBody(state models.GPIOPinState) string {
+	return fmt.Sprintf(`{"type":"gpiostat","device_mac":"%s","notification":{"all_pins":[{"conn_name":"Pump relay-I","conn_type":1,"conn_pin":33,"pin_state":%d}]}}`, testDevID, state)
+}
+
+func alarmBody(severity string) string {
+	return fmt.Sprintf(`{"type":"alarm","device_mac":"%s","notification":{"severity":"%s","code":"PUMP_DRYRUN","message":"Pump running dry"}}`, testDevID, severity)
+}
+
+func TestHndlDeviceNotifics(t *testing.T) {
+	t.Run("invalid_fields", func(t *testing.T) {
+		r, snd := setupHandler(t, 10, 1, "-100")
+		w, result := postNotification(r, `{"type":"gpiostat","device_mac":"`+testDevID+`","notification":{"all_pins":[{"conn_pin":41,"pin_state":2}]}}`, "")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Len(t, result["fields"], 2)
+		assert.Equal(t, 0, snd.count())
+	})
+	t.Run("duplicate_idempotency_key", func(t *testing.T) {
+		r, snd := setupHandler(t, 10, 1, "-100")
+		w, first := postNotification(r, alarmBody("warning"), "alarm-1")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		w, again := postNotification(r, alarmBody("warning"), "alarm-1")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, first["delivery_id"], again["delivery_id"], "Retry was expected to get the original result")
+		assert.Eventually(t, func() bool { return snd.count() == 1 }, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, 1, snd.count(), "Retry was not expected to be sent again")
+	})
+	t.Run("enqueue_failed", func(t *testing.T) {
+		r, _ := setupHandler(t, 1, 0, "-100")
+		w, _ := postNotification(r, gpioBody(models.DIGIPIN_LOW), "")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		before, _ := pinStates.Snapshot(testDevID)
+
+		// queue is now full, and no workers to drain it
+		w, _ = postNotification(r, gpioBody(models.DIGIPIN_HIGH), "gpio-2")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		snap, _ := pinStates.Snapshot(testDevID)
+		assert.Equal(t, before, snap, "Pins were expected to be reverted so that the retry is diffed against the state before")
+		_, claimed := idempotency.Claim(testDevID, "gpio-2")
+		assert.True(t, claimed, "Idempotency key was expected to be forgotten so that the retry is not taken as a repeat")
+	})
+	t.Run("enqueue_partly_failed", func(t *testing.T) {
+		r, _ := setupHandler(t, 1, 0, "-100", "-200")
+		w, result := postNotification(r, gpioBody(models.DIGIPIN_LOW), "gpio-1")
+		assert.Equal(t, http.StatusAccepted, w.Code, "Notification queued for any of the chats is accepted")
+		assert.Len(t, result["delivery_ids"], 1)
+		_, ok := pinStates.Snapshot(testDevID)
+		assert.True(t, ok, "Pins were not expected to be reverted")
+		_, claimed := idempotency.Claim(testDevID, "gpio-1")
+		assert.False(t, claimed, "Idempotency key was expected to be remembered")
+	})
+	t.Run("digest_urgent", func(t *testing.T) {
+		r, snd := setupHandler(t, 10, 1, "-100")
+		digested := []string{}
+		digest = delivery.NewDigest(time.Hour, []string{"-100"}, nil, nil, func(chatID, txt string) error {
+			digested = append(digested, txt)
+			return nil
+		})
+		w, result := postNotification(r, alarmBody("warning"), "")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, true, result["digest"])
+		assert.Nil(t, result["delivery_id"], "Warning was expected to wait for the digest")
+
+		w, result = postNotification(r, alarmBody("critical"), "")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.NotNil(t, result["delivery_id"], "Critical alarm was expected to be sent right away")
+		assert.Eventually(t, func() bool { return snd.count() == 1 }, time.Second, 10*time.Millisecond)
+
+		digest.Flush()
+		assert.Len(t, digested, 1)
+		assert.Contains(t, digested[0], "Pump running dry")
+	})
+	t.Run("suppressor_urgent", func(t *testing.T) {
+		r, snd := setupHandler(t, 10, 1, "-100")
+		suppressor = delivery.NewSuppressor(time.Hour)
+		_, result := postNotification(r, alarmBody("warning"), "")
+		assert.NotNil(t, result["delivery_id"])
+		_, result = postNotification(r, alarmBody("warning"), "")
+		assert.Equal(t, true, result["suppressed"], "Repeat of the warning was expected to be suppressed")
+		for i := 0; i < 2; i++ {
+			_, result = postNotification(r, alarmBody("critical"), "")
+			assert.NotNil(t, result["delivery_id"], "Critical alarms were not expected to be suppressed")
+		}
+		assert.Eventually(t, func() bool { return snd.count() == 3 }, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,98 @@
+package models
+
+/* Ad-hoc alerts from the device - pump dry run, water level sensor trip, cfgwatch failure.
+Severity decides how the alarm is rendered and whether the group hears it. */
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type AlarmSeverity string
+
+const (
+	ALARM_INFO     AlarmSeverity = "info"     // delivered silently
+	ALARM_WARNING  AlarmSeverity = "warning"  // delivered with sound
+	ALARM_CRITICAL AlarmSeverity = "critical" // delivered with sound, right away even for groups on digest
+)
+
+var (
+	/*
+		Alarm : alert raised by the device
+		severity	: info, warning or critical
+		code		: short code for the alarm ex: PUMP_DRYRUN, that the operators can look up
+		msg			: human readable message
+		ctx			: optional key/value details ex: level: 12cm */
+	Alarm = func(severity AlarmSeverity, code, msg string, ctx map[string]string) DeviceNotifcn {
+		return &alarm{
+			Severity: severity,
+			Code:     code,
+			Message:  msg,
+			Context:  ctx,
+		}
+	}
+)
+
+func init() {
+	RegisterKind(&Kind{
+		Name:     "alarm",
+		New:      func() DeviceNotifcn { return Alarm("", "", "", nil) },
+		Event:    true,
+		Validate: func(n DeviceNotifcn) error { return n.(*alarm).validate() },
+	})
+}
+
+type alarm struct {
+	Severity AlarmSeverity     `json:"severity"`
+	Code     string            `json:"code"`
+	Message  string            `json:"message"`
+	Context  map[string]string `json:"context,omitempty"` // optional details of the alarm
+}
+
+func (al *alarm) validate() error {
+	fe := FieldErrors{}
+	switch al.Severity {
+	case ALARM_INFO, ALARM_WARNING, ALARM_CRITICAL:
+	case "":
+		fe.add("severity", "is required")
+	default:
+		fe.add("severity", "%q is not a known severity, expected info, warning or critical", al.Severity)
+	}
+	if al.Code == "" {
+		fe.add("code", "is required")
+	}
+	if al.Message == "" {
+		fe.add("message", "is required")
+	}
+	return fe.errOrNil()
+}
+
+func (al *alarm) Silent() bool {
+	return al.Severity == ALARM_INFO
+}
+
+func (al *alarm) Urgent() bool {
+	return al.Severity == ALARM_CRITICAL
+}
+
+func (al *alarm) ToMessageTxt() (string, error) {
+	var result string
+	switch al.Severity {
+	case ALARM_CRITICAL:
+		result = fmt.Sprintf("%c%c\t*CRITICAL* %s\n%s", EMOJI_siren, EMOJI_siren, mdCode(al.Code), mdEscape(al.Message))
+	case ALARM_WARNING:
+		result = fmt.Sprintf("%c\t*Warning* %s\n%s", EMOJI_warning, mdCode(al.Code), mdEscape(al.Message))
+	default:
+		result = fmt.Sprintf("%c\t_Info_ %s\n%s", EMOJI_info, mdCode(al.Code), mdEscape(al.Message))
+	}
+	keys := make([]string, 0, len(al.Context))
+	for k := range al.Context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // same alarm renders the same, else suppression would not see the repeats
+	lines := []string{result}
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%s: %s", mdEscape(k), mdEscape(al.Context[k])))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlarm(t *testing.T) {
+	data := []struct {
+		body   string
+		fields []string
+		silent bool
+		urgent bool
+		txt    string
+	}{
+		{body: `{"severity":"critical","code":"PUMP_DRYRUN","message":"Pump running dry","context":{"level":"2cm","pump":"Pump relay-I"}}`, urgent: true, txt: "*CRITICAL* `PUMP_DRYRUN`\nPump running dry\nlevel: 2cm\npump: Pump relay-I"},
+		{body: `{"severity":"critical","code":"PUMP_DRYRUN","message":"pump_1 dry *now*"}`, urgent: true, txt: "*CRITICAL* `PUMP_DRYRUN`\npump\\_1 dry \\*now\\*"},
+		{body: `{"severity":"warning","code":"LEVEL_LOW","message":"Sump level low"}`, txt: "*Warning* `LEVEL_LOW`\nSump level low"},
+		{body: `{"severity":"info","code":"CFGWATCH_RESTART","message":"cfgwatch restarted"}`, silent: true, txt: "_Info_ `CFGWATCH_RESTART`\ncfgwatch restarted"},
+		{body: `{"severity":"warning","code":"LEVEL_LOW","message":"Sump below *min_level*","context":{"level_cm":"12","sensor":"us_[1]"}}`, txt: "*Warning* `LEVEL_LOW`\nSump below \\*min\\_level\\*\nlevel\\_cm: 12\nsensor: us\\_\\[1]"},
+		{body: `{"severity":"panic","message":"Pump running dry"}`, fields: []string{"notification.severity", "notification.code"}},
+		{body: `{}`, fields: []string{"notification.severity", "notification.code", "notification.message"}},
+	}
+	for _, d := range data {
+		not, err := ParseNotification([]byte(`{"type":"alarm","device_mac":"b8:27:eb:a5:be:48","notification":`+d.body+`}`), "")
+		assert.Nil(t, err)
+		err = Validate(not, "b8:27:eb:a5:be:48")
+		if d.fields != nil {
+			fe, _ := err.(FieldErrors)
+			got := []string{}
+			for _, e := range fe {
+				got = append(got, e.Field)
+			}
+			assert.Equal(t, d.fields, got, "Unexpected offending fields for %s", d.body)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected validation error for %s", d.body)
+		assert.Equal(t, d.silent, not.Specific().(Audible).Silent())
+		assert.Equal(t, d.urgent, not.Specific().(Urgent).Urgent())
+		txt, err := not.Specific().ToMessageTxt()
+		assert.Nil(t, err)
+		assert.Contains(t, txt, d.txt)
+	}
+}
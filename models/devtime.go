@@ -0,0 +1,87 @@
+package models
+
+/* Date and time as the devices send it in the notification.
+Devices with a proper clock send RFC3339, the older ones send the local wall clock without a zone.
+The wall clock is then read in the timezone of the device, once that is known. */
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	DeviceTimeLayout = "2006-01-02 15:04:05" // local wall clock on the device, as from `date "+%Y-%m-%d %H:%M:%S"`
+)
+
+// DeviceTime : time from the device, zero when the device did not send one
+type DeviceTime struct {
+	Time  time.Time
+	Naive bool // sent without a zone, wall clock is in the timezone of the device
+}
+
+func (dt *DeviceTime) UnmarshalJSON(byt []byte) error {
+	*dt = DeviceTime{}
+	if string(byt) == "null" {
+		return nil
+	}
+	var val string
+	if err := json.Unmarshal(byt, &val); err != nil {
+		return fmt.Errorf("expected a date time string")
+	}
+	if val == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		dt.Time = t
+		return nil
+	}
+	t, err := time.ParseInLocation(DeviceTimeLayout, val, time.UTC)
+	if err != nil {
+		return fmt.Errorf("%q is neither RFC3339 nor %s", val, DeviceTimeLayout)
+	}
+	dt.Time, dt.Naive = t, true
+	return nil
+}
+
+func (dt DeviceTime) MarshalJSON() ([]byte, error) {
+	switch {
+	case dt.IsZero():
+		return []byte("null"), nil
+	case dt.Naive:
+		return json.Marshal(dt.Time.Format(DeviceTimeLayout))
+	}
+	return json.Marshal(dt.Time.Format(time.RFC3339Nano))
+}
+
+func (dt DeviceTime) IsZero() bool {
+	return dt.Time.IsZero()
+}
+
+/* In : time in the location, wall clock of naive times is taken to be in the location itself */
+func (dt DeviceTime) In(loc *time.Location) time.Time {
+	if dt.Naive {
+		t := dt.Time
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+	return dt.Time.In(loc)
+}
+
+// Seconds : duration from the device, in whole seconds over the wire
+type Seconds time.Duration
+
+func (s *Seconds) UnmarshalJSON(byt []byte) error {
+	var secs float64
+	if err := json.Unmarshal(byt, &secs); err != nil {
+		return fmt.Errorf("expected duration in seconds")
+	}
+	*s = Seconds(time.Duration(secs * float64(time.Second)).Round(time.Second))
+	return nil
+}
+
+func (s Seconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int64(time.Duration(s).Seconds()))
+}
+
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(s)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceTime(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	assert.Nil(t, err)
+	data := []struct {
+		val   string
+		err   bool
+		naive bool
+		inIST string // as rendered in the device timezone
+	}{
+		{val: `"2024-03-10 15:04:05"`, naive: true, inIST: "2024-03-10T15:04:05+05:30"},
+		{val: `"2024-03-10T09:34:05Z"`, inIST: "2024-03-10T15:04:05+05:30"},
+		{val: `"2024-03-10T15:04:05+05:30"`, inIST: "2024-03-10T15:04:05+05:30"},
+		{val: `null`},
+		{val: `""`},
+		{val: `"10/03/2024 15:04"`, err: true},
+		{val: `1710063245`, err: true},
+	}
+	for _, d := range data {
+		dt := DeviceTime{}
+		err := json.Unmarshal([]byte(d.val), &dt)
+		if d.err {
+			assert.NotNil(t, err, "Expected error for %s", d.val)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected error for %s", d.val)
+		assert.Equal(t, d.naive, dt.Naive)
+		if d.inIST == "" {
+			assert.True(t, dt.IsZero())
+			continue
+		}
+		assert.Equal(t, d.inIST, dt.In(ist).Format(time.RFC3339))
+		// marshals back the same way
+		byt, err := json.Marshal(dt)
+		assert.Nil(t, err)
+		again := DeviceTime{}
+		assert.Nil(t, json.Unmarshal(byt, &again))
+		assert.Equal(t, d.inIST, again.In(ist).Format(time.RFC3339))
+	}
+}
+
+func TestNotificationDate(t *testing.T) {
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	now := time.Now().In(ist)
+	t.Run("rendered_in_device_timezone", func(t *testing.T) {
+		body := `{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","dt":"` + now.Format(DeviceTimeLayout) + `","notification":{}}`
+		not, err := ParseNotification([]byte(body), "")
+		assert.Nil(t, err)
+		not.SetLocation(ist)
+		txt, _ := not.ToMessageTxt()
+		assert.Contains(t, txt, now.Format(time.RFC822))
+		assert.Less(t, not.ClockSkew().Abs(), 2*time.Second, "Device clock in sync was not expected to be skewed")
+		not.SetLocation(time.UTC) // wall clock read as utc is ahead by the offset
+		assert.InDelta(t, 5*time.Hour+30*time.Minute, not.ClockSkew(), float64(2*time.Second))
+	})
+	t.Run("legacy_date", func(t *testing.T) {
+		body := `{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","CurrDate":"` + now.Add(-10*time.Minute).Format(time.RFC3339) + `","notification":{}}`
+		not, err := ParseNotification([]byte(body), "")
+		assert.Nil(t, err)
+		assert.InDelta(t, -10*time.Minute, not.ClockSkew(), float64(2*time.Second))
+	})
+	t.Run("no_date", func(t *testing.T) {
+		not, err := ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{}}`), "")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Duration(0), not.ClockSkew())
+		txt, _ := not.ToMessageTxt()
+		assert.NotContains(t, txt, "01 Jan 01", "Notification without date was expected to have the time it was received")
+	})
+	t.Run("invalid_date", func(t *testing.T) {
+		not, err := ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","dt":"yesterday","notification":{}}`), "")
+		assert.Nil(t, err, "Invalid date is reported on validation")
+		err = Validate(not, "b8:27:eb:a5:be:48")
+		fe, ok := err.(FieldErrors)
+		assert.True(t, ok)
+		assert.Equal(t, "dt", fe[0].Field)
+	})
+}
@@ -1,25 +1,32 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
+	"math"
 	"time"
 
 	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/eensymachines-in/webpi-telegnotify/parsers"
 )
 
 var (
 	/* Notification: generic body of the notification to be sent
 	specific notification is an attachment to this generic on
 	*/
-	Notification = func(name, mac string, dt time.Time, specific DeviceNotifcn) DeviceNotifcn {
-		return &anyNotification{
+	Notification = func(name, mac string, dt time.Time, specific DeviceNotifcn) Envelope {
+		result := &anyNotification{
 			DeviceName:   name,
 			DeviceMac:    mac,
-			CurrDate:     dt,
+			CurrDate:     DeviceTime{Time: dt},
 			Notification: specific, // cfgchange, gpio status, vitalstats
+			kind:         kindOf(specific),
+			received:     time.Now(),
 		}
+		if result.kind != nil {
+			result.Type, result.SchemaVersion = result.kind.Name, result.kind.version()
+		}
+		return result
 	}
 	/*
 		CfgChange: is the specific notification denoting the change in the device configuration  */
@@ -42,6 +49,16 @@ var (
 			PinState: state,
 		}
 	}
+	/*
+		AnalogStatus : pin read as analog, ex: AnalogStatus("Soil moisture", 3, 1.82, "V").OnBus(BUS_I2C) */
+	AnalogStatus = func(name string, pin int, value float64, unit string) *Pinstat {
+		return &Pinstat{ConnName: name, ConnType: SENSOR, ConnPin: pin, PinState: PIN_ANALOG, Analog: &value, Unit: unit}
+	}
+	/*
+		PWMStatus : pin driven with PWM, duty as percentage ex: PWMStatus("Pump-II", 12, 65) */
+	PWMStatus = func(name string, pin int, duty float64) *Pinstat {
+		return &Pinstat{ConnName: name, ConnType: ACTUATOR, ConnPin: pin, PinState: PIN_PWM, Duty: &duty}
+	}
 	/*
 		GpioStatus: overall gpio status , collates the pin status at any given point in tim
 	*/
@@ -53,52 +70,52 @@ var (
 		}
 	}
 	/*
-		VitalStats: constructor function for vital stats of the device
-		All the parameters are bash command outputs that go into making the object
-		Arguments as string are then converted to appropriate boolean flags
+		Vitals: constructor function for vital stats of the device, with whichever systemd units the device runs
+		All the parameters are bash command outputs that go into making the object, read using the parsers
+		Output that cannot be parsed leaves the value unknown
 
-		aqpsrv: echo -n $(systemctl is-active service)
-		service active status : "active" ==true, else false
+		online: curl -Is https://www.google.com
+		online when there is any HTTP response, whichever the version
 
-		online: echo -n $(curl -Is https://www.google.com | head -n 1)
-		online  == HTTP/2 200 then true else false.
+		vmstat: vmstat 1 2
+		full output, or the context switches and user usage the older firmware sent ex: 780 16
 
-		vmstat: echo -n $(vmstat | awk '{print $12" "$13}' | tail -1)
-		gives space separated usage in % for user &system ex: 16 7
+		uptime: uptime
+		full output, uptime -p or /proc/uptime
 
-		uptime: echo -n $(uptime | awk '{print $3" "$4" "$5}'| rev | cut -c 2- | rev)
-		gives the uptime of the cpu
+		health: SoC temperature, memory, disks, load and network as the device knows them, nil when not known
+		ex: (&Health{Memory: &MemUsage{TotalMB: 1024, UsedMB: 512}}).WithSoCTemp(52.1)
 
-		dt = time.Now()
-		local time on the device
+		services: units on the device ex: UnitStatus("aquapone.service", out) or ServiceStatus("cfgwatch.service", true)
 	*/
-	VitalStats = func(aqpsrv, cfgwatchsrv, online, vmstat, uptime string) DeviceNotifcn {
-		service_status := func(status string) bool {
-			return status == "active"
-		}
-		return &vitalStats{
-			AquaponeSrv: service_status(aqpsrv),
-			CfgwatchSrv: service_status(cfgwatchsrv),
-			Online: func(cmdop string) bool {
-				return cmdop == "HTTP/2 200"
-			}(online),
-			FreeCPU: func(vmstatop string) int {
-				bits := strings.Split(vmstatop, " ")
-				if len(bits) != 2 {
-					return -1 // error condition
-				}
-				usage := 0
-				for _, b := range bits {
-					val, err := strconv.ParseInt(b, 10, 32)
-					if err != nil {
-						return -1 //error condition
-					}
-					usage += int(val)
-				}
-				return 100 - usage
-			}(vmstat),
-			CPUUpTime: uptime,
+	Vitals = func(online, vmstat, uptime string, health *Health, services ...*ServiceUnit) DeviceNotifcn {
+		result := &vitalStats{
+			Services: services,
+			FreeCPU:  -1,
+		}
+		if health != nil {
+			result.Health = *health
+		}
+		if _, err := parsers.HTTPStatus(online); err == nil {
+			result.Online = true
 		}
+		if cpu, err := parsers.Vmstat(vmstat); err == nil {
+			result.FreeCPU = cpu.Free()
+		}
+		if up, err := parsers.Uptime(uptime); err == nil {
+			result.UpTime = Seconds(up)
+		}
+		return result
+	}
+	/*
+		VitalStats: vital stats of the device running only aquapone and cfgwatch, as the firmware before the services list
+
+		aqpsrv: systemctl is-active aquapone.service
+		cfgwatchsrv: systemctl is-active cfgwatch.service
+		rest as for Vitals
+	*/
+	VitalStats = func(aqpsrv, cfgwatchsrv, online, vmstat, uptime string) DeviceNotifcn {
+		return Vitals(online, vmstat, uptime, nil, UnitStatus("aquapone.service", aqpsrv), UnitStatus("cfgwatch.service", cfgwatchsrv))
 	}
 )
 
@@ -107,28 +124,208 @@ DeviceData: positively identifies the device. The service as such is ignostic to
 Plus with any other notification this has to be included. Device data now includes the date as well.
 */
 type anyNotification struct {
-	DeviceName   string        `json:"device_name"` // name of the device
-	DeviceMac    string        `json:"device_mac"`  // mac id of the device
-	CurrDate     time.Time     // current date on the device
-	Notification DeviceNotifcn `json:"notification"` // specific notification - gpiostatus/cfgchng/vital stats
+	Type           string         `json:"type,omitempty"`            // kind of the specific notification - cfgchange, gpiostat, vitals
+	SchemaVersion  int            `json:"schema_version,omitempty"`  // version of the specific notification payload, 1 when not sent
+	NotificationID string         `json:"notification_id,omitempty"` // optional id from the device, retries of the same notification carry the same id
+	DeviceName     string         `json:"device_name"`               // name of the device
+	DeviceMac      string         `json:"device_mac"`                // mac id of the device
+	CurrDate       DeviceTime     `json:"dt"`                        // current date on the device, zero when not sent
+	Notification   DeviceNotifcn  `json:"notification"`              // specific notification - gpiostatus/cfgchng/vital stats
+	kind           *Kind          // kind of the specific notification, nil when made without one
+	sentVersion    int            // schema version as the device sent it, before upgrading
+	received       time.Time      // when the notification was received from the device
+	loc            *time.Location // timezone of the device, nil for the server local
+	dateErr        *FieldError    // date from the device that could not be read, reported on validation
+}
+
+/*
+	UnmarshalJSON : specific notification is made as per the type in the body, or the kind already set from the query.
+
+Type in the body that does not match the kind already set is an error, so is a schema version newer than what the kind knows of
+*/
+func (dd *anyNotification) UnmarshalJSON(byt []byte) error {
+	type plain anyNotification // without the UnmarshalJSON, else this would recurse
+	aux := struct {
+		*plain
+		Notification json.RawMessage `json:"notification"`
+		Date         json.RawMessage `json:"dt"`
+		LegacyDate   json.RawMessage `json:"CurrDate"` // as the date was marshalled before it had the json tag
+	}{plain: (*plain)(dd)}
+	dd.Type, dd.SchemaVersion = "", 0
+	if err := json.Unmarshal(byt, &aux); err != nil {
+		return err
+	}
+	dd.CurrDate, dd.dateErr = DeviceTime{}, nil
+	if date, field := aux.Date, "dt"; len(date) > 0 || len(aux.LegacyDate) > 0 {
+		if len(date) == 0 {
+			date, field = aux.LegacyDate, "CurrDate"
+		}
+		if err := json.Unmarshal(date, &dd.CurrDate); err != nil {
+			dd.dateErr = &FieldError{Field: field, Msg: err.Error()}
+		}
+	}
+	switch {
+	case dd.Type == "" && dd.kind == nil:
+		return fmt.Errorf("%w: type of notification neither in the body nor the query", ErrUnknownKind)
+	case dd.Type == "":
+		// older devices send the kind only in the query
+	case dd.kind == nil:
+		k, err := LookupKind(dd.Type)
+		if err != nil {
+			return err
+		}
+		dd.kind = k
+	case dd.kind.Name != dd.Type:
+		return fmt.Errorf("%w: %s in the body, %s in the query", ErrKindMismatch, dd.Type, dd.kind.Name)
+	}
+	dd.Type = dd.kind.Name
+	if dd.SchemaVersion == 0 {
+		dd.SchemaVersion = 1
+	}
+	if dd.SchemaVersion > dd.kind.version() {
+		return fmt.Errorf("%w: %s v%d, latest known is v%d", ErrUnsupportedVersion, dd.Type, dd.SchemaVersion, dd.kind.version())
+	}
+	dd.sentVersion = dd.SchemaVersion
+	dd.SchemaVersion = dd.kind.version() // once upgraded the notification is of the current version
+	dd.Notification = dd.kind.New()
+	if len(aux.Notification) == 0 || string(aux.Notification) == "null" {
+		return nil // validation is left to the kind
+	}
+	raw, err := dd.kind.upgrade(aux.Notification, dd.sentVersion)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dd.Notification)
+}
+
+/* SentVersion : schema version the device sent, older than the current when the notification was upgraded */
+func (dd *anyNotification) SentVersion() int {
+	if dd.sentVersion == 0 {
+		return dd.SchemaVersion
+	}
+	return dd.sentVersion
+}
+
+func (dd *anyNotification) Kind() *Kind {
+	return dd.kind
+}
+
+func (dd *anyNotification) ID() string {
+	return dd.NotificationID
+}
+
+func (dd *anyNotification) Specific() DeviceNotifcn {
+	return dd.Notification
+}
+
+/* SetLocation : timezone of the device, the date is rendered in this and naive dates from the device are read in this */
+func (dd *anyNotification) SetLocation(loc *time.Location) {
+	dd.loc = loc
+	if l, ok := dd.Notification.(Localized); ok {
+		l.SetLocation(loc)
+	}
+}
+
+func (dd *anyNotification) location() *time.Location {
+	if dd.loc == nil {
+		return time.Local
+	}
+	return dd.loc
+}
+
+/* when : date of the notification in the device timezone, time it was received when the device did not send one */
+func (dd *anyNotification) when() time.Time {
+	if dd.CurrDate.IsZero() {
+		return dd.received.In(dd.location())
+	}
+	return dd.CurrDate.In(dd.location())
+}
+
+/* ClockSkew : how far ahead the device clock is of the time the notification was received, 0 when the device did not send the date */
+func (dd *anyNotification) ClockSkew() time.Duration {
+	if dd.CurrDate.IsZero() || dd.received.IsZero() {
+		return 0
+	}
+	return dd.CurrDate.In(dd.location()).Sub(dd.received)
+}
+
+/* ToHeaderTxt : device details atop any message */
+func (dd *anyNotification) ToHeaderTxt() string {
+	return fmt.Sprintf("*%s*\n_%s_", dd.DeviceName, dd.DeviceMac)
 }
 
 func (dd *anyNotification) ToMessageTxt() (string, error) {
-	notifcn, err := dd.Notification.ToMessageTxt()
+	render := dd.Notification.ToMessageTxt
+	if dd.kind != nil {
+		render = func() (string, error) { return dd.kind.render(dd.Notification) }
+	}
+	notifcn, err := render()
 	if err != nil {
-		result := fmt.Sprintf("*%s*\n_%s_\n%s\n----\n There was an error reading the device notification", dd.DeviceName, dd.DeviceMac, dd.CurrDate.Local().Format(time.RFC822))
+		result := fmt.Sprintf("%s\n%s\n----\n There was an error reading the device notification", dd.ToHeaderTxt(), dd.when().Format(time.RFC822))
 		return result, nil
 	}
-	result := fmt.Sprintf("*%s*\n_%s_\n%s\n----\n%s", dd.DeviceName, dd.DeviceMac, dd.CurrDate.Local().Format(time.RFC822), notifcn)
+	result := fmt.Sprintf("%s\n%s\n----\n%s", dd.ToHeaderTxt(), dd.when().Format(time.RFC822), notifcn)
+	return result, nil
+}
+
+/* ToRepeatedTxt : when the same notification was repeated since it was last sent, this summarises the repeats */
+func (dd *anyNotification) ToRepeatedTxt(times int, since time.Time) (string, error) {
+	result := fmt.Sprintf("%s\n----\n%c\tPrevious notification repeated %d times since %s", dd.ToHeaderTxt(), EMOJI_recycle, times, since.In(dd.location()).Format("15:04"))
 	return result, nil
 }
 
 /* ++++++++++++++++++++++++++++++++++++++++++++++++ */
 
+func init() {
+	RegisterKind(&Kind{
+		Name:     "cfgchange",
+		New:      func() DeviceNotifcn { return CfgChange(nil) },
+		Event:    true,
+		Validate: func(n DeviceNotifcn) error { return n.(*cfgChangeNotification).validate() },
+	})
+	RegisterKind(&Kind{
+		Name:     "gpiostat",
+		New:      func() DeviceNotifcn { return GpioStatus() },
+		Validate: func(n DeviceNotifcn) error { return n.(*gpioStatus).validate() },
+	})
+	RegisterKind(&Kind{
+		Name:     "vitals",
+		New:      func() DeviceNotifcn { return &vitalStats{FreeCPU: -1} },
+		Validate: func(n DeviceNotifcn) error { return n.(*vitalStats).validate() },
+		Version:  3,
+		Upgrades: map[int]Upgrade{1: upgradeVitalsV1, 2: upgradeVitalsV2},
+	})
+}
+
+/* ++++++++++++++++++++++++++++++++++++++++++++++++ */
+
 type cfgChangeNotification struct {
 	New *aquacfg.Schedule `json:"new"` // new schedule just applied
 }
 
+func (ccn *cfgChangeNotification) validate() error {
+	fe := FieldErrors{}
+	if ccn.New == nil {
+		fe.add("new", "is required")
+		return fe
+	}
+	if ccn.New.Config > aquacfg.PULSE_EVERY_DAYAT {
+		fe.add("new.config", "%d is not a known schedule, expected 0-%d", ccn.New.Config, aquacfg.PULSE_EVERY_DAYAT)
+	}
+	if ccn.New.TickAt == "" && (ccn.New.Config == aquacfg.TICK_EVERY_DAYAT || ccn.New.Config == aquacfg.PULSE_EVERY_DAYAT) {
+		fe.add("new.tickat", "is required for schedules at a time of the day")
+	} else if ccn.New.TickAt != "" && !hhmmFormat.MatchString(ccn.New.TickAt) {
+		fe.add("new.tickat", "%q is not a time of the day, expected HH:MM", ccn.New.TickAt)
+	}
+	if ccn.New.Interval < 0 {
+		fe.add("new.interval", "cannot be negative")
+	}
+	if ccn.New.PulseGap < 0 {
+		fe.add("new.pulsegap", "cannot be negative")
+	}
+	return fe.errOrNil()
+}
+
 func (ccn *cfgChangeNotification) ToMessageTxt() (string, error) {
 	result := "New configuration applied.."
 	if ccn.New != nil {
@@ -142,27 +339,129 @@ func (ccn *cfgChangeNotification) ToMessageTxt() (string, error) {
 /* ++++++++++++++++++++++++++++++++++++++++++++++++ */
 /* PinStatus: contains a single pin status - slice of pin status go into gpio status */
 type Pinstat struct {
-	ConnName string         `json:"conn_name"` // name of the connection ex: Pump-I, Pump-II, Lights
-	ConnType GPIOConnection `json:"conn_type"` // Actuattion /Sensory node
-	ConnPin  int            `json:"conn_pin"`  // numeral identification of the pin
-	PinState GPIOPinState   `json:"pin_state"` // Pin state - 0,1,float
+	ConnName string         `json:"conn_name"`        // name of the connection ex: Pump-I, Pump-II, Lights
+	ConnType GPIOConnection `json:"conn_type"`        // Actuattion /Sensory node
+	ConnPin  int            `json:"conn_pin"`         // numeral identification of the pin
+	PinState GPIOPinState   `json:"pin_state"`        // Pin state - 0,1,float, analog, pwm
+	Bus      GPIOBus        `json:"bus,omitempty"`    // bus the connection is on, GPIO when not sent
+	Analog   *float64       `json:"analog,omitempty"` // value read when the pin is analog
+	Unit     string         `json:"unit,omitempty"`   // unit of the analog value ex: V, mV, %
+	Duty     *float64       `json:"duty,omitempty"`   // duty cycle in % when the pin is PWM
+}
+
+/* OnBus : connection on a bus other than GPIO */
+func (p *Pinstat) OnBus(bus GPIOBus) *Pinstat {
+	p.Bus = bus
+	return p
 }
 
 type gpioStatus struct {
 	AllPins []*Pinstat `json:"all_pins"` // since there are multiple pins reported in a notification
+
+	changes []PinChange // against the last known state, rendered instead of all the pins when diffed
+	diffed  bool
+}
+
+/* Track : pins are recorded as the last known state of the device, unless full the changes are then rendered instead of all the pins */
+func (gps *gpioStatus) Track(pt *PinTracker, devid string, full bool) (*PinSnapshot, bool) {
+	snap, changes, first := pt.Record(devid, gps.AllPins)
+	if first || full {
+		return snap, true
+	}
+	gps.changes, gps.diffed = changes, true
+	return snap, len(changes) > 0
+}
+
+func (gps *gpioStatus) validate() error {
+	fe := FieldErrors{}
+	if len(gps.AllPins) == 0 {
+		fe.add("all_pins", "at least one pin is required")
+	}
+	for i, p := range gps.AllPins {
+		field := fmt.Sprintf("all_pins[%d]", i)
+		if p == nil {
+			fe.add(field, "is empty")
+			continue
+		}
+		if p.ConnName == "" {
+			fe.add(field+".conn_name", "is required")
+		}
+		// pins on the other buses are addresses or channels, not pins on the header
+		if p.Bus == BUS_GPIO && (p.ConnPin < headerPinMin || p.ConnPin > headerPinMax) {
+			fe.add(field+".conn_pin", "%d is not on the header, expected %d-%d", p.ConnPin, headerPinMin, headerPinMax)
+		}
+		if p.PinState > PIN_PWM {
+			fe.add(field+".pin_state", "%d is not a known state, expected %d-%d", p.PinState, DIGIPIN_LOW, PIN_PWM)
+		}
+		if p.ConnType > ACTUATOR {
+			fe.add(field+".conn_type", "%d is not a known connection, expected %d-%d", p.ConnType, SENSOR, ACTUATOR)
+		}
+		if p.Bus > BUS_ONEWIRE {
+			fe.add(field+".bus", "%d is not a known bus, expected %d-%d", p.Bus, BUS_GPIO, BUS_ONEWIRE)
+		}
+		switch {
+		case p.PinState == PIN_ANALOG && p.Analog == nil:
+			fe.add(field+".analog", "is required for analog pins")
+		case p.PinState != PIN_ANALOG && p.Analog != nil:
+			fe.add(field+".analog", "is only for analog pins")
+		}
+		switch {
+		case p.PinState == PIN_PWM && p.Duty == nil:
+			fe.add(field+".duty", "is required for PWM pins")
+		case p.PinState != PIN_PWM && p.Duty != nil:
+			fe.add(field+".duty", "is only for PWM pins")
+		case p.Duty != nil && (*p.Duty < 0 || *p.Duty > 100):
+			fe.add(field+".duty", "%s is not a percentage", fmtValue(*p.Duty))
+		}
+	}
+	return fe.errOrNil()
+}
+
+/* toStateTxt : state of the pin as it is shown, digital pins up or down, analog with the value and PWM with the duty */
+func (p *Pinstat) toStateTxt() string {
+	switch p.PinState {
+	case DIGIPIN_HIGH:
+		return fmt.Sprintf("%c", EMOJI_up)
+	case DIGIPIN_LOW:
+		return fmt.Sprintf("%c", EMOJI_down)
+	case DIGIPIN_FLOAT:
+		return fmt.Sprintf("%c floating", EMOJI_warning)
+	case PIN_ANALOG:
+		if p.Analog != nil {
+			return fmt.Sprintf("%c %s%s", EMOJI_meter, fmtValue(math.Round(*p.Analog*100)/100), mdEscape(p.Unit))
+		}
+	case PIN_PWM:
+		if p.Duty != nil {
+			return fmt.Sprintf("%c %s%%", EMOJI_gear, fmtValue(math.Round(*p.Duty*10)/10))
+		}
+	}
+	return fmt.Sprintf("%c", EMOJI_redcross)
 }
 
 /* With the device details on the top this can print status of each pin name and sattus if high or low */
 func (gps *gpioStatus) ToMessageTxt() (string, error) {
+	if gps.diffed {
+		if len(gps.changes) == 0 {
+			return fmt.Sprintf("%c\tNo change in the pins\n", EMOJI_greentick), nil
+		}
+		result := ""
+		for _, pc := range gps.changes {
+			result = fmt.Sprintf("%s%s\n", result, pc.toChangeTxt())
+		}
+		return result, nil
+	}
+	return gps.ToFullTxt()
+}
+
+/* ToFullTxt : all the pins as reported, even when tracked */
+func (gps *gpioStatus) ToFullTxt() (string, error) {
 	result := ""
 	for _, p := range gps.AllPins {
-		state := EMOJI_redcross
-		if p.PinState == DIGIPIN_HIGH {
-			state = EMOJI_up
-		} else if p.PinState == DIGIPIN_LOW {
-			state = EMOJI_down
+		name := mdEscape(p.ConnName)
+		if p.Bus != BUS_GPIO {
+			name = fmt.Sprintf("%s (%s)", name, p.Bus)
 		}
-		result = fmt.Sprintf("%s%s:\t\t%c\n", result, p.ConnName, state)
+		result = fmt.Sprintf("%s%s:\t\t%s\n", result, name, p.toStateTxt())
 	}
 	return result, nil
 }
@@ -171,26 +470,60 @@ func (gps *gpioStatus) ToMessageTxt() (string, error) {
 
 /* VitalStatsData: is the object that eventually gets converted to text message in bot send */
 type vitalStats struct {
-	AquaponeSrv bool   `json:"aquapone_service"` // indicates if the systemctl unit is working
-	CfgwatchSrv bool   `json:"cfgwatch_service"` // indicates if the systemctl unit is working
-	Online      bool   `json:"online"`           // indicates if the device is online, on internet
-	FreeCPU     int    `json:"free_cpu"`         // indicates percentage of CPU that is free
-	CPUUpTime   string `json:"cpu_uptime"`       // indicates the cpu up time from uptime command
+	Services []*ServiceUnit `json:"services"`    // systemd units on the device, since v2
+	Online   bool           `json:"online"`      // indicates if the device is online, on internet
+	FreeCPU  int            `json:"free_cpu"`    // indicates percentage of CPU that is free
+	UpTime   Seconds        `json:"uptime_secs"` // time since the device booted, since v3, 0 when not known
+
+	Health // SoC temperature, memory, disks, load and network, all optional
+
+	loc *time.Location
 }
 
-func (vs *vitalStats) ToMessageTxt() (string, error) {
-	// default result if everything else fails
-	result := ""
-	if vs.AquaponeSrv {
-		result = fmt.Sprintf("%s\n%c\tAquapone.service", result, EMOJI_runner)
-	} else {
-		result = fmt.Sprintf("%s\n%c\tAquapone.service", result, EMOJI_redcross)
+/* SetLocation : timezone of the device, service timestamps are rendered in this */
+func (vs *vitalStats) SetLocation(loc *time.Location) {
+	vs.loc = loc
+}
+
+func (vs *vitalStats) validate() error {
+	fe := FieldErrors{}
+	if vs.FreeCPU < -1 || vs.FreeCPU > 100 {
+		fe.add("free_cpu", "%d is not a percentage", vs.FreeCPU)
 	}
-	if vs.CfgwatchSrv {
-		result = fmt.Sprintf("%s\n%c\tCfgwatch.service", result, EMOJI_runner)
-	} else {
-		result = fmt.Sprintf("%s\n%c\tCfgwatch.service", result, EMOJI_redcross)
+	if vs.UpTime < 0 {
+		fe.add("uptime_secs", "cannot be negative")
 	}
+	vs.validateServices(&fe)
+	vs.validateHealth(&fe)
+	return fe.errOrNil()
+}
+
+/*
+	upgradeVitalsV2 : cpu_uptime as cut out of the uptime output on the device becomes uptime_secs in v3
+
+uptime that cannot be parsed is dropped, and is then unknown
+*/
+func upgradeVitalsV2(old json.RawMessage) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(old, &fields); err != nil {
+		return nil, err
+	}
+	if raw, ok := fields["cpu_uptime"]; ok {
+		var uptime string
+		if err := json.Unmarshal(raw, &uptime); err != nil {
+			return nil, fmt.Errorf("cpu_uptime: %w", err)
+		}
+		delete(fields, "cpu_uptime")
+		if up, err := parsers.Uptime(uptime); err == nil {
+			fields["uptime_secs"] = json.RawMessage(fmt.Sprintf("%d", int64(up.Seconds())))
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func (vs *vitalStats) ToMessageTxt() (string, error) {
+	// default result if everything else fails
+	result := vs.toServicesTxt()
 	if vs.Online {
 		result = fmt.Sprintf("%s\n%c\tDevice online", result, EMOJI_greentick)
 	} else {
@@ -201,7 +534,12 @@ func (vs *vitalStats) ToMessageTxt() (string, error) {
 	} else {
 		result = fmt.Sprintf("%s\n%c\tCPU free: %c", result, EMOJI_free, EMOJI_redqs)
 	}
-	result = fmt.Sprintf("%s\n%c\tCPU up since: %s", result, EMOJI_clock, vs.CPUUpTime)
+	if vs.UpTime > 0 {
+		result = fmt.Sprintf("%s\n%c\tUp for: %s", result, EMOJI_clock, humanDuration(vs.UpTime.Duration()))
+	} else {
+		result = fmt.Sprintf("%s\n%c\tUp for: %c", result, EMOJI_clock, EMOJI_redqs)
+	}
+	result = fmt.Sprintf("%s%s", result, vs.toHealthTxt())
 	return result, nil
 }
 
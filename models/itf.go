@@ -3,6 +3,7 @@ package models
 import (
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -30,10 +31,26 @@ var (
 	EMOJI_runner, _    = strconv.ParseInt(strings.TrimPrefix("\\U1F3C3", "\\U"), 16, 32)
 	EMOJI_up, _        = strconv.ParseInt(strings.TrimPrefix("\\U1F53C", "\\U"), 16, 32)
 	EMOJI_down, _      = strconv.ParseInt(strings.TrimPrefix("\\U1F53D", "\\U"), 16, 32)
+	EMOJI_siren, _     = strconv.ParseInt(strings.TrimPrefix("\\U1F6A8", "\\U"), 16, 32)
+	EMOJI_info, _      = strconv.ParseInt(strings.TrimPrefix("\\U2139", "\\U"), 16, 32)
+	EMOJI_meter, _     = strconv.ParseInt(strings.TrimPrefix("\\U1F4CF", "\\U"), 16, 32)
+	EMOJI_rocket, _    = strconv.ParseInt(strings.TrimPrefix("\\U1F680", "\\U"), 16, 32)
+	EMOJI_plug, _      = strconv.ParseInt(strings.TrimPrefix("\\U1F50C", "\\U"), 16, 32)
+	EMOJI_package, _   = strconv.ParseInt(strings.TrimPrefix("\\U1F4E6", "\\U"), 16, 32)
+	EMOJI_antenna, _   = strconv.ParseInt(strings.TrimPrefix("\\U1F4E1", "\\U"), 16, 32)
+	EMOJI_arrow, _     = strconv.ParseInt(strings.TrimPrefix("\\U2192", "\\U"), 16, 32)
+	EMOJI_thermo, _    = strconv.ParseInt(strings.TrimPrefix("\\U1F321", "\\U"), 16, 32)
+	EMOJI_memory, _    = strconv.ParseInt(strings.TrimPrefix("\\U1F9E0", "\\U"), 16, 32)
+	EMOJI_disk, _      = strconv.ParseInt(strings.TrimPrefix("\\U1F4BE", "\\U"), 16, 32)
+	EMOJI_chart, _     = strconv.ParseInt(strings.TrimPrefix("\\U1F4C8", "\\U"), 16, 32)
+	EMOJI_signal, _    = strconv.ParseInt(strings.TrimPrefix("\\U1F4F6", "\\U"), 16, 32)
+	EMOJI_globe, _     = strconv.ParseInt(strings.TrimPrefix("\\U1F310", "\\U"), 16, 32)
+	EMOJI_gear, _      = strconv.ParseInt(strings.TrimPrefix("\\U2699", "\\U"), 16, 32)
 )
 
 type GPIOConnection uint8 // sensor or actuator
-type GPIOPinState uint8   // since we are dealing with digital pin only 3 possible outcomes - high, low, floating
+type GPIOPinState uint8   // digital pins are high, low or floating, the rest are read as analog or driven as PWM
+type GPIOBus uint8        // bus / protocol the connection is on
 
 /*
 denotes the connection type to the gpio
@@ -50,9 +67,70 @@ const (
 	DIGIPIN_LOW GPIOPinState = iota
 	DIGIPIN_FLOAT
 	DIGIPIN_HIGH
+	PIN_ANALOG // value read from an ADC, sent with the analog value and unit
+	PIN_PWM    // driven with PWM, sent with the duty cycle
 )
 
+/*
+denotes the bus the connection is on, GPIO when not sent
+ADC sensors are often on I2C, temperature probes on 1-Wire
+*/
+const (
+	BUS_GPIO GPIOBus = iota
+	BUS_I2C
+	BUS_SPI
+	BUS_ONEWIRE
+)
+
+func (b GPIOBus) String() string {
+	switch b {
+	case BUS_GPIO:
+		return "GPIO"
+	case BUS_I2C:
+		return "I2C"
+	case BUS_SPI:
+		return "SPI"
+	case BUS_ONEWIRE:
+		return "1-Wire"
+	}
+	return "unknown"
+}
+
 // DeviceNotifcn : Any struct that can beconverted to BotText as a message that can be dispatched to Telegram
 type DeviceNotifcn interface {
 	ToMessageTxt() (string, error) // any object to text messages with emojis
 }
+
+// Audible : notifications that decide if the telegram message makes a sound, all the others do
+type Audible interface {
+	Silent() bool // true when the message is to be delivered without a sound
+}
+
+// PinTracked : notifications that can be rendered as changes against the last known state of the device
+type PinTracked interface {
+	Track(pt *PinTracker, devid string, full bool) (*PinSnapshot, bool) // snapshot recorded, false when nothing changed since the last known state
+	ToFullTxt() (string, error)                                         // full state as reported, irrespective of the changes
+}
+
+// Urgent : notifications that can not wait for the digest, they are sent right away
+type Urgent interface {
+	Urgent() bool
+}
+
+// Localized : notifications that render times of their own, these get the timezone of the device
+type Localized interface {
+	SetLocation(loc *time.Location)
+}
+
+// Envelope : generic notification that carries the device details along with the specific notification
+type Envelope interface {
+	DeviceNotifcn
+	Kind() *Kind                                              // kind of the specific notification, nil if not of a registered kind
+	SentVersion() int                                         // schema version as sent by the device, before any upgrades
+	ID() string                                               // id the device has given the notification, empty if none
+	Specific() DeviceNotifcn                                  // specific notification - gpiostatus/cfgchng/vital stats
+	ToHeaderTxt() string                                      // device details atop any message
+	SetLocation(loc *time.Location)                           // timezone of the device, to be set before rendering
+	ClockSkew() time.Duration                                 // device clock ahead of the server by, negative when behind
+	ToRepeatedTxt(times int, since time.Time) (string, error) // summary when the notification was repeated since
+}
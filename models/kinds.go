@@ -0,0 +1,156 @@
+package models
+
+/* Registry of the kinds of notifications the devices can send.
+Each kind registers itself with a name, and the handler looks up the kind from the name the device sends.
+New kinds can be added in this package without touching the handler. */
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownKind        = fmt.Errorf("unknown kind of notification")
+	ErrKindMismatch       = fmt.Errorf("kind of notification in the body does not match the one in the query")
+	ErrUnsupportedVersion = fmt.Errorf("unsupported schema version of notification")
+)
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = map[string]*Kind{}
+)
+
+// Kind : a kind of device notification, ex: cfgchange, gpiostat, vitals
+type Kind struct {
+	Name     string                                // name as the device sends it
+	New      func() DeviceNotifcn                  // empty notification onto which the payload is unmarshalled
+	Validate func(n DeviceNotifcn) error           // checks the notification once unmarshalled, nil when nothing to check
+	Render   func(n DeviceNotifcn) (string, error) // text for the notification, nil to use its own ToMessageTxt
+	Event    bool                                  // each one of them matters, and not just the latest - digests list all of them
+	Version  int                                   // current schema version of the payload, 1 when not set
+	Upgrades map[int]Upgrade                       // shims keyed by the version they upgrade from, each to the next version
+}
+
+/*
+	Upgrade : converts the payload of the specific notification from one schema version to the next.
+
+Older firmware on the field sends older payloads, these are upgraded to the current model before anything else
+*/
+type Upgrade func(old json.RawMessage) (json.RawMessage, error)
+
+/* Notification : empty envelope with the specific notification of this kind, payload from the device is unmarshalled onto this */
+func (k *Kind) Notification() Envelope {
+	return &anyNotification{
+		Type:          k.Name,
+		SchemaVersion: k.version(),
+		received:      time.Now(),
+		Notification:  k.New(),
+		kind:          k,
+	}
+}
+
+func (k *Kind) version() int {
+	if k.Version < 1 {
+		return 1
+	}
+	return k.Version
+}
+
+/* upgrade : payload of the version upgraded one version at a time to the current */
+func (k *Kind) upgrade(raw json.RawMessage, from int) (json.RawMessage, error) {
+	for v := from; v < k.version(); v++ {
+		up, ok := k.Upgrades[v]
+		if !ok {
+			return nil, fmt.Errorf("%w: no upgrade for %s from v%d", ErrUnsupportedVersion, k.Name, v)
+		}
+		var err error
+		if raw, err = up(raw); err != nil {
+			return nil, fmt.Errorf("failed to upgrade %s from v%d: %w", k.Name, v, err)
+		}
+	}
+	return raw, nil
+}
+
+/* render : text of the specific notification as the kind would have it */
+func (k *Kind) render(n DeviceNotifcn) (string, error) {
+	if k.Render != nil {
+		return k.Render(n)
+	}
+	return n.ToMessageTxt()
+}
+
+/*
+	RegisterKind : makes the kind available to the handlers by its name.
+
+Registering the same name twice is a programming error and panics
+*/
+func RegisterKind(k *Kind) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	if k == nil || k.Name == "" || k.New == nil {
+		panic("models: kind needs a name and a factory")
+	}
+	if _, ok := kinds[k.Name]; ok {
+		panic(fmt.Sprintf("models: kind %s registered twice", k.Name))
+	}
+	kinds[k.Name] = k
+}
+
+/* LookupKind : kind registered against the name, ErrUnknownKind if none */
+func LookupKind(name string) (*Kind, error) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	k, ok := kinds[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, name)
+	}
+	return k, nil
+}
+
+/* kindOf : kind the specific notification belongs to, nil if its not of any registered kind */
+func kindOf(n DeviceNotifcn) *Kind {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	for _, k := range kinds {
+		if reflect.TypeOf(k.New()) == reflect.TypeOf(n) {
+			return k
+		}
+	}
+	return nil
+}
+
+/*
+	ParseNotification : notification from the json body, kind of which is as the body says.
+
+typ is the kind from the query string for older devices that dont send the type in the body, empty when not known.
+When both are present they have to match
+*/
+func ParseNotification(byt []byte, typ string) (Envelope, error) {
+	not := &anyNotification{received: time.Now()}
+	if typ != "" {
+		k, err := LookupKind(typ)
+		if err != nil {
+			return nil, err
+		}
+		not.kind = k
+	}
+	if err := json.Unmarshal(byt, not); err != nil {
+		return nil, err
+	}
+	return not, nil
+}
+
+/* Kinds : names of all the registered kinds, sorted */
+func Kinds() []string {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	result := make([]string, 0, len(kinds))
+	for name := range kinds {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKinds(t *testing.T) {
+	assert.Subset(t, Kinds(), []string{"cfgchange", "gpiostat", "vitals"})
+	assert.IsIncreasing(t, Kinds(), "Kinds were expected to be sorted")
+	_, err := LookupKind("")
+	assert.ErrorIs(t, err, ErrUnknownKind)
+	_, err = LookupKind("weather")
+	assert.ErrorIs(t, err, ErrUnknownKind)
+	assert.Panics(t, func() { RegisterKind(&Kind{Name: "vitals", New: func() DeviceNotifcn { return GpioStatus() }}) }, "Registering a kind twice was expected to panic")
+
+	t.Run("unmarshal_and_validate", func(t *testing.T) {
+		data := []struct {
+			typ   string
+			body  string
+			valid bool
+		}{
+			{typ: "cfgchange", body: `{"device_name":"Aquaponics pump control-I","notification":{"new":{"config":1,"tickat":"13:30","interval":100,"pulsegap":50}}}`, valid: true},
+			{typ: "cfgchange", body: `{"device_name":"Aquaponics pump control-I","notification":{}}`, valid: false},
+			{typ: "gpiostat", body: `{"device_name":"Aquaponics pump control-I","notification":{"all_pins":[{"conn_name":"Pump relay-I","conn_pin":33,"pin_state":2}]}}`, valid: true},
+			{typ: "gpiostat", body: `{"device_name":"Aquaponics pump control-I","notification":{"all_pins":[]}}`, valid: false},
+			{typ: "vitals", body: `{"device_name":"Aquaponics pump control-I","notification":{"online":true,"free_cpu":80}}`, valid: true},
+		}
+		for _, d := range data {
+			kind, err := LookupKind(d.typ)
+			assert.Nil(t, err)
+			not := kind.Notification()
+			assert.Nil(t, json.Unmarshal([]byte(d.body), &not), "Unexpected error when unmarshalling %s", d.typ)
+			err = nil
+			if kind.Validate != nil {
+				err = kind.Validate(not.Specific())
+			}
+			assert.Equal(t, d.valid, err == nil, "Unexpected validation of %s: %s", d.typ, d.body)
+			if d.valid {
+				txt, err := not.ToMessageTxt()
+				assert.Nil(t, err)
+				assert.Contains(t, txt, "Aquaponics pump control-I")
+			}
+		}
+	})
+	t.Run("gpiostat_analog_pwm", func(t *testing.T) {
+		gps := GpioStatus(
+			PinStatus("Pump relay-I", ACTUATOR, 33, DIGIPIN_HIGH),
+			PinStatus("Float switch", SENSOR, 35, DIGIPIN_FLOAT),
+			AnalogStatus("Soil moisture", 0x48, 1.8234, "V").OnBus(BUS_I2C),
+			PWMStatus("Pump-II", 12, 65),
+		)
+		assert.Nil(t, gps.(*gpioStatus).validate(), "I2C address was not expected to be checked as a header pin")
+		txt, err := gps.ToMessageTxt()
+		assert.Nil(t, err)
+		lines := strings.Split(strings.TrimSpace(txt), "\n")
+		assert.Equal(t, "Pump relay-I:\t\t"+string(rune(EMOJI_up)), lines[0])
+		assert.Equal(t, "Float switch:\t\t"+string(rune(EMOJI_warning))+" floating", lines[1])
+		assert.Equal(t, "Soil moisture (I2C):\t\t"+string(rune(EMOJI_meter))+" 1.82V", lines[2])
+		assert.Equal(t, "Pump-II:\t\t"+string(rune(EMOJI_gear))+" 65%", lines[3])
+		assert.NotContains(t, txt, string(rune(EMOJI_redcross)))
+	})
+}
+
+func TestParseNotification(t *testing.T) {
+	data := []struct {
+		body string
+		typ  string
+		err  error
+		kind string
+	}{
+		{body: `{"type":"vitals","device_name":"Aquaponics pump control-I","notification":{"online":true}}`, kind: "vitals"},
+		{body: `{"device_name":"Aquaponics pump control-I","notification":{"online":true}}`, typ: "vitals", kind: "vitals"},
+		{body: `{"type":"vitals","device_name":"Aquaponics pump control-I","notification":{"online":true}}`, typ: "vitals", kind: "vitals"},
+		{body: `{"type":"vitals","device_name":"Aquaponics pump control-I","notification":{"online":true}}`, typ: "gpiostat", err: ErrKindMismatch},
+		{body: `{"device_name":"Aquaponics pump control-I","notification":{"online":true}}`, err: ErrUnknownKind},
+		{body: `{"type":"weather","device_name":"Aquaponics pump control-I"}`, err: ErrUnknownKind},
+		{body: `{"type":"vitals","schema_version":99,"device_name":"Aquaponics pump control-I"}`, err: ErrUnsupportedVersion},
+	}
+	for _, d := range data {
+		not, err := ParseNotification([]byte(d.body), d.typ)
+		if d.err != nil {
+			assert.ErrorIs(t, err, d.err, "Unexpected error for %s", d.body)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected error for %s", d.body)
+		assert.Equal(t, d.kind, not.Kind().Name)
+		// once parsed, the payload describes itself
+		byt, err := json.Marshal(not)
+		assert.Nil(t, err)
+		again, err := ParseNotification(byt, "")
+		assert.Nil(t, err)
+		assert.Equal(t, d.kind, again.Kind().Name)
+		assert.Contains(t, string(byt), fmt.Sprintf(`"schema_version":%d`, not.Kind().version()), "Parsed notification was expected to be of the current version")
+	}
+}
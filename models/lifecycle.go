@@ -0,0 +1,185 @@
+package models
+
+/* Lifecycle of the device - boot, graceful shutdown, software updates and reconnecting after being offline.
+Each one of them is an event, operators follow the history of the device in the group from these. */
+import (
+	"fmt"
+	"time"
+)
+
+type UpdatePhase string
+
+const (
+	UPDATE_START   UpdatePhase = "start"
+	UPDATE_SUCCESS UpdatePhase = "success"
+	UPDATE_FAILURE UpdatePhase = "failure"
+)
+
+var (
+	/*
+		Boot : device has booted
+		firmware	: version of the firmware it booted with
+		reason		: reason for the reboot ex: power_on, watchdog, update, manual */
+	Boot = func(firmware, reason string) DeviceNotifcn {
+		return &bootNotification{Firmware: firmware, Reason: reason}
+	}
+	/* Shutdown : device is shutting down gracefully, reason is optional */
+	Shutdown = func(reason string) DeviceNotifcn {
+		return &shutdownNotification{Reason: reason}
+	}
+	/*
+		SoftwareUpdate : progress of the update on the device
+		phase	: start, success or failure
+		from,to	: versions the device is updating from and to
+		errMsg	: reason of failure, empty otherwise */
+	SoftwareUpdate = func(phase UpdatePhase, from, to, errMsg string) DeviceNotifcn {
+		return &updateNotification{Phase: phase, FromVersion: from, ToVersion: to, Error: errMsg}
+	}
+	/* Reconnect : device is back online after being offline for a while */
+	Reconnect = func(offline time.Duration) DeviceNotifcn {
+		return &reconnectNotification{OfflineSecs: int64(offline.Seconds())}
+	}
+)
+
+func init() {
+	RegisterKind(&Kind{
+		Name:     "boot",
+		New:      func() DeviceNotifcn { return Boot("", "") },
+		Event:    true,
+		Validate: func(n DeviceNotifcn) error { return n.(*bootNotification).validate() },
+	})
+	RegisterKind(&Kind{
+		Name:  "shutdown",
+		New:   func() DeviceNotifcn { return Shutdown("") },
+		Event: true,
+	})
+	RegisterKind(&Kind{
+		Name:     "update",
+		New:      func() DeviceNotifcn { return SoftwareUpdate("", "", "", "") },
+		Event:    true,
+		Validate: func(n DeviceNotifcn) error { return n.(*updateNotification).validate() },
+	})
+	RegisterKind(&Kind{
+		Name:     "reconnect",
+		New:      func() DeviceNotifcn { return Reconnect(0) },
+		Event:    true,
+		Validate: func(n DeviceNotifcn) error { return n.(*reconnectNotification).validate() },
+	})
+}
+
+/* humanDuration : duration as the operators would read it, ex: 2d 3h, 1h 5m, 45m, 30s */
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	days, hrs, mins := int(d.Hours())/24, int(d.Hours())%24, int(d.Minutes())%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hrs)
+	case hrs > 0:
+		return fmt.Sprintf("%dh %dm", hrs, mins)
+	case mins > 0:
+		return fmt.Sprintf("%dm", mins)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+/* ++++++++++++++++++++++++++++++++++++++++++++++++ */
+
+type bootNotification struct {
+	Firmware string `json:"firmware"` // version of the firmware booted with
+	Reason   string `json:"reason"`   // reason for the reboot, empty when not known
+}
+
+func (bn *bootNotification) validate() error {
+	fe := FieldErrors{}
+	if bn.Firmware == "" {
+		fe.add("firmware", "is required")
+	}
+	return fe.errOrNil()
+}
+
+func (bn *bootNotification) ToMessageTxt() (string, error) {
+	reason := mdEscape(bn.Reason)
+	if reason == "" {
+		reason = "unknown"
+	}
+	return fmt.Sprintf("%c\tDevice booted\nFirmware: %s\nReason: %s", EMOJI_rocket, mdCode(bn.Firmware), reason), nil
+}
+
+/* ++++++++++++++++++++++++++++++++++++++++++++++++ */
+
+type shutdownNotification struct {
+	Reason string `json:"reason,omitempty"` // optional reason for the shutdown
+}
+
+func (sn *shutdownNotification) ToMessageTxt() (string, error) {
+	if sn.Reason == "" {
+		return fmt.Sprintf("%c\tDevice shutting down", EMOJI_plug), nil
+	}
+	return fmt.Sprintf("%c\tDevice shutting down\nReason: %s", EMOJI_plug, mdEscape(sn.Reason)), nil
+}
+
+/* ++++++++++++++++++++++++++++++++++++++++++++++++ */
+
+type updateNotification struct {
+	Phase       UpdatePhase `json:"phase"`
+	FromVersion string      `json:"from_version,omitempty"`
+	ToVersion   string      `json:"to_version"`
+	Error       string      `json:"error,omitempty"` // reason of failure
+}
+
+func (un *updateNotification) validate() error {
+	fe := FieldErrors{}
+	switch un.Phase {
+	case UPDATE_START, UPDATE_SUCCESS, UPDATE_FAILURE:
+	case "":
+		fe.add("phase", "is required")
+	default:
+		fe.add("phase", "%q is not a known phase, expected start, success or failure", un.Phase)
+	}
+	if un.ToVersion == "" {
+		fe.add("to_version", "is required")
+	}
+	return fe.errOrNil()
+}
+
+/* Silent : update starting is only for the record, the outcome is what the group needs to hear */
+func (un *updateNotification) Silent() bool {
+	return un.Phase == UPDATE_START
+}
+
+func (un *updateNotification) ToMessageTxt() (string, error) {
+	versions := mdCode(un.ToVersion)
+	if un.FromVersion != "" {
+		versions = fmt.Sprintf("%s %c %s", mdCode(un.FromVersion), EMOJI_arrow, mdCode(un.ToVersion))
+	}
+	switch un.Phase {
+	case UPDATE_START:
+		return fmt.Sprintf("%c\tSoftware update started\n%s", EMOJI_package, versions), nil
+	case UPDATE_SUCCESS:
+		return fmt.Sprintf("%c\tSoftware update done\n%s", EMOJI_greentick, versions), nil
+	}
+	result := fmt.Sprintf("%c\tSoftware update failed\n%s", EMOJI_redcross, versions)
+	if un.Error != "" {
+		result = fmt.Sprintf("%s\nError: %s", result, mdEscape(un.Error))
+	}
+	return result, nil
+}
+
+/* ++++++++++++++++++++++++++++++++++++++++++++++++ */
+
+type reconnectNotification struct {
+	OfflineSecs int64 `json:"offline_secs"` // time for which the device was offline
+}
+
+func (rn *reconnectNotification) validate() error {
+	fe := FieldErrors{}
+	if rn.OfflineSecs < 0 {
+		fe.add("offline_secs", "cannot be negative")
+	}
+	return fe.errOrNil()
+}
+
+func (rn *reconnectNotification) ToMessageTxt() (string, error) {
+	offline := time.Duration(rn.OfflineSecs) * time.Second
+	return fmt.Sprintf("%c\tBack online after %s offline", EMOJI_antenna, humanDuration(offline)), nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	data := []struct {
+		typ    string
+		body   string
+		fields []string
+		silent bool
+		txt    string
+	}{
+		{typ: "boot", body: `{"firmware":"2.4.1","reason":"watchdog"}`, txt: "Device booted\nFirmware: `2.4.1`\nReason: watchdog"},
+		{typ: "boot", body: `{"reason":"watchdog"}`, fields: []string{"notification.firmware"}},
+		{typ: "shutdown", body: `{"reason":"maintenance"}`, txt: "Device shutting down\nReason: maintenance"},
+		{typ: "shutdown", body: `{}`, txt: "Device shutting down"},
+		{typ: "boot", body: `{"firmware":"2.4.1_rc` + "`" + `1","reason":"power_on"}`, txt: "Firmware: `2.4.1_rc'1`\nReason: power\\_on"},
+		{typ: "shutdown", body: `{"reason":"low_battery *now*"}`, txt: "Reason: low\\_battery \\*now\\*"},
+		{typ: "update", body: `{"phase":"failure","to_version":"2.5.0","error":"no space on /dev/mmcblk0p2 [rootfs_b]"}`, txt: "Error: no space on /dev/mmcblk0p2 \\[rootfs\\_b]"},
+		{typ: "update", body: `{"phase":"start","from_version":"2.4.1","to_version":"2.5.0"}`, silent: true, txt: "Software update started\n`2.4.1` → `2.5.0`"},
+		{typ: "update", body: `{"phase":"success","to_version":"2.5.0"}`, txt: "Software update done\n`2.5.0`"},
+		{typ: "update", body: `{"phase":"failure","to_version":"2.5.0","error":"checksum mismatch"}`, txt: "Software update failed\n`2.5.0`\nError: checksum mismatch"},
+		{typ: "update", body: `{"phase":"rollback"}`, fields: []string{"notification.phase", "notification.to_version"}},
+		{typ: "reconnect", body: `{"offline_secs":7500}`, txt: "Back online after 2h 5m offline"},
+		{typ: "reconnect", body: `{"offline_secs":-1}`, fields: []string{"notification.offline_secs"}},
+	}
+	for _, d := range data {
+		not, err := ParseNotification([]byte(`{"device_mac":"b8:27:eb:a5:be:48","notification":`+d.body+`}`), d.typ)
+		assert.Nil(t, err)
+		err = Validate(not, "b8:27:eb:a5:be:48")
+		if d.fields != nil {
+			fe, _ := err.(FieldErrors)
+			got := []string{}
+			for _, e := range fe {
+				got = append(got, e.Field)
+			}
+			assert.Equal(t, d.fields, got, "Unexpected offending fields for %s %s", d.typ, d.body)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected validation error for %s %s", d.typ, d.body)
+		assert.True(t, not.Kind().Event, "Lifecycle notifications are events")
+		a, ok := not.Specific().(Audible)
+		assert.Equal(t, d.silent, ok && a.Silent())
+		txt, err := not.Specific().ToMessageTxt()
+		assert.Nil(t, err)
+		assert.Contains(t, txt, d.txt)
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	data := map[time.Duration]string{
+		30 * time.Second:                "30s",
+		45*time.Minute + 10*time.Second: "45m",
+		65 * time.Minute:                "1h 5m",
+		51 * time.Hour:                  "2d 3h",
+		0:                               "0s",
+	}
+	for d, want := range data {
+		assert.Equal(t, want, humanDuration(d))
+	}
+}
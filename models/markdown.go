@@ -0,0 +1,19 @@
+package models
+
+/* Messages go to telegram with the markdown parse mode, text from the devices is escaped before it goes into them.
+Otherwise an underscore as in "power_on" opens an entity that is never closed, and telegram rejects the message */
+import (
+	"strings"
+)
+
+var mdEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+/* mdEscape : free text from the device, to be rendered as is outside of any entity */
+func mdEscape(txt string) string {
+	return mdEscaper.Replace(txt)
+}
+
+/* mdCode : text from the device in a code span, nothing can be escaped inside the span hence backticks are replaced */
+func mdCode(txt string) string {
+	return "`" + strings.ReplaceAll(txt, "`", "'") + "`"
+}
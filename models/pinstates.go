@@ -0,0 +1,190 @@
+package models
+
+/* Last known state of the pins on each of the devices, so that a gpio status can be told apart from the one before.
+Readers of the group are then shown only the pins that changed, the full snapshot is still at hand when asked for.
+State is in memory, after a restart the first status from each device is shown in full */
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	/* NewPinTracker : tracker with no device reported yet */
+	NewPinTracker = func() *PinTracker {
+		return &PinTracker{devices: map[string]*pinHistory{}}
+	}
+)
+
+// PinSnapshot : pins as the device last reported them
+type PinSnapshot struct {
+	DevID string     `json:"devid"`
+	At    time.Time  `json:"at"` // when the snapshot was received
+	Pins  []*Pinstat `json:"pins"`
+}
+
+// PinChange : a pin that is not as it was last reported, From is nil for pins new to the report, To is nil for pins no longer reported
+type PinChange struct {
+	Name string
+	From *Pinstat
+	To   *Pinstat
+}
+
+const (
+	pinHistoryDepth = 4 // snapshots kept per device, reports that could not be delivered fall back on the ones before
+)
+
+type pinHistory struct {
+	snaps []*PinSnapshot // oldest first, the last is the known state. Reverted snapshots are dropped
+}
+
+func (ph *pinHistory) curr() *PinSnapshot {
+	return ph.snaps[len(ph.snaps)-1]
+}
+
+type PinTracker struct {
+	mu      sync.Mutex
+	devices map[string]*pinHistory // device id
+}
+
+/*
+	Record : pins as reported now by the device become its last known state.
+
+Changes are against the state known before, first is true when nothing was known of the device.
+Snapshot recorded is what is to be handed back to Revert.
+*/
+func (pt *PinTracker) Record(devid string, pins []*Pinstat) (snap *PinSnapshot, changes []PinChange, first bool) {
+	copied := make([]*Pinstat, 0, len(pins))
+	for _, p := range pins {
+		if p != nil {
+			cp := *p
+			copied = append(copied, &cp)
+		}
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	snap = &PinSnapshot{DevID: devid, At: time.Now(), Pins: copied}
+	hist, ok := pt.devices[devid]
+	if !ok {
+		pt.devices[devid] = &pinHistory{snaps: []*PinSnapshot{snap}}
+		return snap, nil, true
+	}
+	prev := hist.curr()
+	hist.snaps = append(hist.snaps, snap)
+	if len(hist.snaps) > pinHistoryDepth {
+		hist.snaps = hist.snaps[len(hist.snaps)-pinHistoryDepth:]
+	}
+	return snap, diffPins(prev.Pins, copied), false
+}
+
+/*
+	Revert : snapshot recorded is dropped, as when the status could not be delivered and the device shall retry.
+
+Last known state is then the latest of the snapshots that were not reverted, a report recorded since stands.
+When none are left the next report from the device is shown in full
+*/
+func (pt *PinTracker) Revert(devid string, snap *PinSnapshot) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	hist, ok := pt.devices[devid]
+	if !ok || snap == nil {
+		return
+	}
+	for i, s := range hist.snaps {
+		if s == snap {
+			hist.snaps = append(hist.snaps[:i], hist.snaps[i+1:]...)
+			break
+		}
+	}
+	if len(hist.snaps) == 0 {
+		delete(pt.devices, devid)
+	}
+}
+
+/* Snapshot : last known pins of the device, false when the device has not reported any */
+func (pt *PinTracker) Snapshot(devid string) (*PinSnapshot, bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	hist, ok := pt.devices[devid]
+	if !ok {
+		return nil, false
+	}
+	return hist.curr(), true
+}
+
+/* Snapshots : last known pins of all the devices, sorted by device */
+func (pt *PinTracker) Snapshots() []*PinSnapshot {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	result := []*PinSnapshot{}
+	for _, hist := range pt.devices {
+		result = append(result, hist.curr())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DevID < result[j].DevID })
+	return result
+}
+
+/* diffPins : pins are matched by their name, order is as in the new report and the ones dropped at the end */
+func diffPins(before, after []*Pinstat) []PinChange {
+	known := map[string]*Pinstat{}
+	for _, p := range before {
+		known[p.ConnName] = p
+	}
+	result := []PinChange{}
+	for _, p := range after {
+		old, ok := known[p.ConnName]
+		delete(known, p.ConnName)
+		if ok && old.sameState(p) {
+			continue
+		}
+		result = append(result, PinChange{Name: p.ConnName, From: old, To: p})
+	}
+	for _, p := range before {
+		if _, gone := known[p.ConnName]; gone {
+			result = append(result, PinChange{Name: p.ConnName, From: p})
+		}
+	}
+	return result
+}
+
+func (p *Pinstat) sameState(other *Pinstat) bool {
+	sameVal := func(a, b *float64) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+	}
+	return p.PinState == other.PinState && p.Bus == other.Bus && p.Unit == other.Unit && sameVal(p.Analog, other.Analog) && sameVal(p.Duty, other.Duty)
+}
+
+/* stateName : state of the pin in words, as used in the changes ex: LOW, HIGH, 1.82V, PWM 65% */
+func (p *Pinstat) stateName() string {
+	switch p.PinState {
+	case DIGIPIN_LOW:
+		return "LOW"
+	case DIGIPIN_HIGH:
+		return "HIGH"
+	case DIGIPIN_FLOAT:
+		return "FLOAT"
+	case PIN_ANALOG:
+		if p.Analog != nil {
+			return fmt.Sprintf("%s%s", fmtValue(math.Round(*p.Analog*100)/100), p.Unit)
+		}
+	case PIN_PWM:
+		if p.Duty != nil {
+			return fmt.Sprintf("PWM %s%%", fmtValue(math.Round(*p.Duty*10)/10))
+		}
+	}
+	return "unknown"
+}
+
+/* toChangeTxt : ex: Pump relay-I: LOW → HIGH */
+func (pc PinChange) toChangeTxt() string {
+	name := mdEscape(pc.Name)
+	switch {
+	case pc.From == nil:
+		return fmt.Sprintf("%s: %s (new)", name, mdEscape(pc.To.stateName()))
+	case pc.To == nil:
+		return fmt.Sprintf("%s: %s → not reported", name, mdEscape(pc.From.stateName()))
+	}
+	return fmt.Sprintf("%s: %s %c %s", name, mdEscape(pc.From.stateName()), EMOJI_arrow, mdEscape(pc.To.stateName()))
+}
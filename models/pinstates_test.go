@@ -0,0 +1,76 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinTracker(t *testing.T) {
+	devid := "b8:27:eb:a5:be:48"
+	pt := NewPinTracker()
+	var last *PinSnapshot
+	report := func(full bool, pins ...*Pinstat) (string, bool) {
+		gps := GpioStatus(pins...).(*gpioStatus)
+		snap, changed := gps.Track(pt, devid, full)
+		last = snap
+		txt, _ := gps.ToMessageTxt()
+		return strings.TrimSpace(txt), changed
+	}
+	relay := func(state GPIOPinState) *Pinstat { return PinStatus("Pump relay-I", ACTUATOR, 33, state) }
+	lights := func(state GPIOPinState) *Pinstat { return PinStatus("Lights", ACTUATOR, 35, state) }
+
+	txt, changed := report(false, relay(DIGIPIN_LOW), lights(DIGIPIN_HIGH))
+	assert.True(t, changed, "First report of the device is a change")
+	assert.Contains(t, txt, "Lights:", "First report is shown in full")
+
+	txt, changed = report(false, relay(DIGIPIN_HIGH), lights(DIGIPIN_HIGH))
+	assert.True(t, changed)
+	assert.Equal(t, "Pump relay-I: LOW → HIGH", txt)
+
+	txt, changed = report(false, relay(DIGIPIN_HIGH), lights(DIGIPIN_HIGH))
+	assert.False(t, changed)
+	assert.Contains(t, txt, "No change in the pins")
+
+	txt, changed = report(false, relay(DIGIPIN_HIGH), PWMStatus("Pump-II", 12, 65))
+	assert.True(t, changed)
+	assert.Equal(t, []string{"Pump-II: PWM 65% (new)", "Lights: HIGH → not reported"}, strings.Split(txt, "\n"))
+
+	txt, _ = report(true, relay(DIGIPIN_HIGH), PWMStatus("Pump-II", 12, 80))
+	assert.Contains(t, txt, "Pump relay-I:", "Full report was asked for")
+	snap, ok := pt.Snapshot(devid)
+	assert.True(t, ok)
+	assert.Equal(t, 80.0, *snap.Pins[1].Duty, "Full report is recorded all the same")
+
+	// report that could not be delivered is reverted, the retry is diffed against the state before
+	report(false, relay(DIGIPIN_LOW), PWMStatus("Pump-II", 12, 80))
+	pt.Revert(devid, last)
+	txt, _ = report(false, relay(DIGIPIN_LOW), PWMStatus("Pump-II", 12, 80))
+	assert.Equal(t, "Pump relay-I: HIGH → LOW", txt)
+
+	// concurrent reports from the device, a report recorded after the one that failed stands
+	delivered := last
+	report(false, relay(DIGIPIN_HIGH), PWMStatus("Pump-II", 12, 80))
+	failed := last
+	report(false, relay(DIGIPIN_LOW), PWMStatus("Pump-II", 12, 80))
+	pt.Revert(devid, failed)
+	snap, _ = pt.Snapshot(devid)
+	assert.Equal(t, last, snap, "Report recorded after the one that failed was expected to stand")
+	// when that too fails, the state is as last delivered and not the one that failed before
+	pt.Revert(devid, last)
+	snap, _ = pt.Snapshot(devid)
+	assert.Equal(t, delivered, snap, "Last delivered snapshot was expected once both reports were reverted")
+	txt, _ = report(false, relay(DIGIPIN_HIGH), PWMStatus("Pump-II", 12, 80))
+	assert.Equal(t, "Pump relay-I: LOW → HIGH", txt)
+
+	pt.Revert("b8:27:eb:2c:31:07", nil)
+	_, ok = pt.Snapshot("b8:27:eb:2c:31:07")
+	assert.False(t, ok)
+	assert.Len(t, pt.Snapshots(), 1)
+
+	gps := GpioStatus(PinStatus("pump_relay", ACTUATOR, 33, DIGIPIN_HIGH)).(*gpioStatus)
+	gps.Track(pt, devid, false)
+	txt, _ = gps.ToFullTxt()
+	assert.Equal(t, "pump\\_relay:\t\t"+string(rune(EMOJI_up)), strings.TrimSpace(txt), "Full state was expected even when tracked, pin names escaped")
+}
@@ -0,0 +1,126 @@
+package models
+
+/* Sensor readings from the device - water temperature, pH, humidity, tank level.
+Unlike the pins that are only high or low, these are real values with a unit, and optionally bounds.
+Values outside their bounds are marked when rendered. */
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	/*
+		SensorReading : single measurement from a sensor
+		name	: name of the sensor / measurement ex: Water temp
+		val		: measured value
+		unit	: unit of the value ex: °C, pH, %, cm */
+	SensorReading = func(name string, val float64, unit string) *Reading {
+		return &Reading{Name: name, Value: val, Unit: unit}
+	}
+	/* Readings : all the sensor readings of a device at a given point in time */
+	Readings = func(rds ...*Reading) DeviceNotifcn {
+		return &readings{Readings: rds}
+	}
+)
+
+func init() {
+	RegisterKind(&Kind{
+		Name:     "readings",
+		New:      func() DeviceNotifcn { return Readings() },
+		Validate: func(n DeviceNotifcn) error { return n.(*readings).validate() },
+	})
+}
+
+// Reading : a measurement from a sensor, with optional bounds within which the value is expected
+type Reading struct {
+	Name  string     `json:"name"`
+	Value float64    `json:"value"`
+	Unit  string     `json:"unit"`
+	At    DeviceTime `json:"at"`            // when the measurement was taken, zero when at the time of the notification
+	Min   *float64   `json:"min,omitempty"` // lower bound, nil when none
+	Max   *float64   `json:"max,omitempty"` // upper bound, nil when none
+}
+
+/* WithBounds : sets the bounds within which the value is expected */
+func (r *Reading) WithBounds(min, max float64) *Reading {
+	r.Min, r.Max = &min, &max
+	return r
+}
+
+/* Below : true when the value is under the lower bound */
+func (r *Reading) Below() bool {
+	return r.Min != nil && r.Value < *r.Min
+}
+
+/* Above : true when the value is over the upper bound */
+func (r *Reading) Above() bool {
+	return r.Max != nil && r.Value > *r.Max
+}
+
+type readings struct {
+	Readings []*Reading `json:"readings"`
+	loc      *time.Location
+}
+
+/* SetLocation : timezone of the device, time of each reading is rendered in this */
+func (rds *readings) SetLocation(loc *time.Location) {
+	rds.loc = loc
+}
+
+func (rds *readings) validate() error {
+	fe := FieldErrors{}
+	if len(rds.Readings) == 0 {
+		fe.add("readings", "at least one reading is required")
+	}
+	for i, r := range rds.Readings {
+		field := fmt.Sprintf("readings[%d]", i)
+		if r == nil {
+			fe.add(field, "is empty")
+			continue
+		}
+		if r.Name == "" {
+			fe.add(field+".name", "is required")
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			fe.add(field+".min", "%s is over the max %s", fmtValue(*r.Min), fmtValue(*r.Max))
+		}
+	}
+	return fe.errOrNil()
+}
+
+/* fmtValue : value as short as it can be without losing precision, 7.20 is 7.2 */
+func fmtValue(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+/* Each reading on a line, ones outside the bounds are marked with the bound they crossed */
+func (rds *readings) ToMessageTxt() (string, error) {
+	loc := rds.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	result := ""
+	for _, r := range rds.Readings {
+		name, unit := mdEscape(r.Name), mdEscape(r.Unit)
+		val := fmtValue(math.Round(r.Value*100) / 100)
+		line := ""
+		switch {
+		case r.Below():
+			// only the value is bold, the unit from the device is escaped and cannot be inside the entity
+			line = fmt.Sprintf("%c\t%s: *%s*%s %c below %s%s", EMOJI_warning, name, val, unit, EMOJI_down, fmtValue(*r.Min), unit)
+		case r.Above():
+			line = fmt.Sprintf("%c\t%s: *%s*%s %c above %s%s", EMOJI_warning, name, val, unit, EMOJI_up, fmtValue(*r.Max), unit)
+		case r.Min != nil || r.Max != nil:
+			line = fmt.Sprintf("%c\t%s: %s%s", EMOJI_greentick, name, val, unit)
+		default:
+			line = fmt.Sprintf("%c\t%s: %s%s", EMOJI_meter, name, val, unit)
+		}
+		if !r.At.IsZero() {
+			line = fmt.Sprintf("%s (%s)", line, r.At.In(loc).Format("15:04"))
+		}
+		result = fmt.Sprintf("%s%s\n", result, line)
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadings(t *testing.T) {
+	body := `{"type":"readings","device_mac":"b8:27:eb:a5:be:48","notification":{"readings":[
+		{"name":"Water temp","value":31.456,"unit":"°C","min":18,"max":28,"at":"2024-03-10 15:04:05"},
+		{"name":"pH","value":5.9,"unit":"","min":6.5,"max":7.5},
+		{"name":"Humidity","value":62,"unit":"%","min":40,"max":80},
+		{"name":"Tank level","value":42,"unit":"cm"},
+		{"name":"water_temp_2","value":24,"unit":"°C"},
+		{"name":"Flow","value":12,"unit":"l_min*","min":20}
+	]}}`
+	not, err := ParseNotification([]byte(body), "")
+	assert.Nil(t, err)
+	assert.Nil(t, Validate(not, "b8:27:eb:a5:be:48"))
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	not.SetLocation(ist)
+	txt, err := not.Specific().ToMessageTxt()
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(txt), "\n")
+	assert.Len(t, lines, 6)
+	assert.Contains(t, lines[0], "Water temp: *31.46*°C")
+	assert.Contains(t, lines[0], "above 28°C (15:04)")
+	assert.Contains(t, lines[1], "pH: *5.9* ")
+	assert.Contains(t, lines[1], "below 6.5")
+	assert.Contains(t, lines[2], string(rune(EMOJI_greentick)))
+	assert.Contains(t, lines[3], "Tank level: 42cm")
+	assert.Contains(t, lines[4], "water\\_temp\\_2: 24°C", "Sensor names were expected escaped for markdown")
+	assert.Contains(t, lines[5], "Flow: *12*l\\_min\\* ", "Units were expected escaped outside the bold value")
+	assert.Contains(t, lines[5], "below 20l\\_min\\*")
+
+	rd := SensorReading("pH", 7, "").WithBounds(6.5, 7.5)
+	assert.False(t, rd.Below() || rd.Above())
+	byt, err := json.Marshal(Readings(rd))
+	assert.Nil(t, err)
+	assert.Contains(t, string(byt), `"min":6.5`)
+
+	not, err = ParseNotification([]byte(`{"type":"readings","device_mac":"b8:27:eb:a5:be:48","notification":{"readings":[{"value":1,"min":5,"max":2}]}}`), "")
+	assert.Nil(t, err)
+	fe, _ := Validate(not, "b8:27:eb:a5:be:48").(FieldErrors)
+	assert.Len(t, fe, 2)
+	assert.Equal(t, "notification.readings[0].name", fe[0].Field)
+	assert.Equal(t, "notification.readings[0].min", fe[1].Field)
+}
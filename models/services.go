@@ -0,0 +1,135 @@
+package models
+
+/* Systemd units running on the device, as part of the vitals.
+Products built on this service run different units, hence vitals carry a list of them instead of fixed flags.
+v1 of the vitals had flags only for aquapone and cfgwatch, those are upgraded to the list. */
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/eensymachines-in/webpi-telegnotify/parsers"
+)
+
+var (
+	/*
+		ServiceStatus : unit with only its name and whether its active, as older firmware would report it
+		ex: ServiceStatus("aquapone.service", true) */
+	ServiceStatus = func(name string, active bool) *ServiceUnit {
+		state := "inactive"
+		if active {
+			state = "active"
+		}
+		return &ServiceUnit{Name: name, ActiveState: state}
+	}
+	/*
+		UnitStatus : unit with its state read from the output of `systemctl is-active <unit>`, inactive when the output cannot be read
+		ex: UnitStatus("pumpctl.service", "active\n") */
+	UnitStatus = func(name, out string) *ServiceUnit {
+		state, err := parsers.ActiveState(out)
+		if err != nil {
+			return ServiceStatus(name, false)
+		}
+		return &ServiceUnit{Name: name, ActiveState: state}
+	}
+	// states as from `systemctl show -p ActiveState`, unknown is when the unit is not loaded
+	unitActiveStates = map[string]bool{
+		"active": true, "reloading": true, "inactive": true, "failed": true, "activating": true, "deactivating": true, "maintenance": true, "refreshing": true, "unknown": true,
+	}
+)
+
+// ServiceUnit : a systemd unit, as from `systemctl show -p ActiveState,SubState,NRestarts,ActiveEnterTimestamp <unit>`
+type ServiceUnit struct {
+	Name        string     `json:"name"`                // ex: aquapone.service
+	ActiveState string     `json:"active_state"`        // active, inactive, failed, activating ..
+	SubState    string     `json:"sub_state,omitempty"` // running, exited, dead ..
+	Restarts    int        `json:"restarts"`            // times the unit was restarted by systemd
+	Since       DeviceTime `json:"since"`               // when the unit entered the active state, zero when not known
+}
+
+/*
+	upgradeVitalsV1 : aquapone_service and cfgwatch_service flags of v1 become units in the services list of v2
+
+Unversioned payloads that already carry the services list are left with it, the flags if any are dropped
+*/
+func upgradeVitalsV1(old json.RawMessage) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(old, &fields); err != nil {
+		return nil, err
+	}
+	services := []*ServiceUnit{}
+	for _, flag := range []struct{ field, unit string }{
+		{"aquapone_service", "aquapone.service"},
+		{"cfgwatch_service", "cfgwatch.service"},
+	} {
+		raw, ok := fields[flag.field]
+		if !ok {
+			continue
+		}
+		var active bool
+		if err := json.Unmarshal(raw, &active); err != nil {
+			return nil, fmt.Errorf("%s: %w", flag.field, err)
+		}
+		services = append(services, ServiceStatus(flag.unit, active))
+		delete(fields, flag.field)
+	}
+	if _, ok := fields["services"]; ok || len(services) == 0 {
+		return json.Marshal(fields)
+	}
+	byt, err := json.Marshal(services)
+	if err != nil {
+		return nil, err
+	}
+	fields["services"] = byt
+	return json.Marshal(fields)
+}
+
+func (vs *vitalStats) validateServices(fe *FieldErrors) {
+	for i, su := range vs.Services {
+		field := fmt.Sprintf("services[%d]", i)
+		if su == nil {
+			fe.add(field, "is empty")
+			continue
+		}
+		if su.Name == "" {
+			fe.add(field+".name", "is required")
+		}
+		if !unitActiveStates[su.ActiveState] {
+			fe.add(field+".active_state", "%q is not a systemd active state", su.ActiveState)
+		}
+		if su.Restarts < 0 {
+			fe.add(field+".restarts", "cannot be negative")
+		}
+	}
+}
+
+/* toServicesTxt : a line for each of the units, active ones running and the rest crossed out */
+func (vs *vitalStats) toServicesTxt() string {
+	loc := vs.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	result := ""
+	for _, su := range vs.Services {
+		state := su.ActiveState
+		if su.SubState != "" {
+			state = fmt.Sprintf("%s/%s", su.ActiveState, su.SubState)
+		}
+		emoji := EMOJI_redcross
+		switch su.ActiveState {
+		case "active", "reloading", "refreshing":
+			emoji = EMOJI_runner
+		case "activating", "deactivating", "maintenance":
+			emoji = EMOJI_warning
+		}
+		line := fmt.Sprintf("%c\t%s: %s", emoji, mdEscape(su.Name), mdEscape(state))
+		if !su.Since.IsZero() {
+			line = fmt.Sprintf("%s since %s", line, su.Since.In(loc).Format("02 Jan 15:04"))
+		}
+		if su.Restarts > 0 {
+			line = fmt.Sprintf("%s, restarted %d times", line, su.Restarts)
+		}
+		result = fmt.Sprintf("%s\n%s", result, line)
+	}
+	return result
+}
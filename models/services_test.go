@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVitalsServices(t *testing.T) {
+	t.Run("v1_flags_upgraded", func(t *testing.T) {
+		not, err := ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{"aquapone_service":true,"cfgwatch_service":false,"online":true,"free_cpu":77}}`), "")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, not.SentVersion())
+		vs := not.Specific().(*vitalStats)
+		assert.Equal(t, []*ServiceUnit{ServiceStatus("aquapone.service", true), ServiceStatus("cfgwatch.service", false)}, vs.Services)
+		assert.Equal(t, 77, vs.FreeCPU, "Rest of the fields were expected as is")
+	})
+	t.Run("unversioned_services", func(t *testing.T) {
+		not, err := ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{"services":[{"name":"pump_ctl.service","active_state":"active"}],"aquapone_service":false,"online":true}}`), "")
+		assert.Nil(t, err)
+		vs := not.Specific().(*vitalStats)
+		assert.Equal(t, []*ServiceUnit{{Name: "pump_ctl.service", ActiveState: "active"}}, vs.Services, "Services sent were expected to be kept over the v1 flags")
+		txt, _ := vs.ToMessageTxt()
+		assert.Contains(t, txt, "pump\\_ctl.service: active")
+
+		not, err = ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{"online":true}}`), "")
+		assert.Nil(t, err)
+		assert.Empty(t, not.Specific().(*vitalStats).Services, "No services were expected without the v1 flags")
+	})
+	t.Run("v2_services", func(t *testing.T) {
+		body := `{"type":"vitals","schema_version":2,"device_mac":"b8:27:eb:a5:be:48","notification":{"online":true,"free_cpu":77,"services":[
+			{"name":"aquapone.service","active_state":"active","sub_state":"running","restarts":0,"since":"2024-03-10 06:00:00"},
+			{"name":"nodered.service","active_state":"failed","sub_state":"failed","restarts":5},
+			{"name":"mosquitto.service","active_state":"activating","sub_state":"auto-restart","restarts":2}
+		]}}`
+		not, err := ParseNotification([]byte(body), "")
+		assert.Nil(t, err)
+		assert.Nil(t, Validate(not, "b8:27:eb:a5:be:48"))
+		ist, _ := time.LoadLocation("Asia/Kolkata")
+		not.SetLocation(ist)
+		txt, _ := not.Specific().ToMessageTxt()
+		lines := strings.Split(strings.TrimSpace(txt), "\n")
+		assert.Equal(t, string(rune(EMOJI_runner))+"\taquapone.service: active/running since 10 Mar 06:00", lines[0])
+		assert.Equal(t, string(rune(EMOJI_redcross))+"\tnodered.service: failed/failed, restarted 5 times", lines[1])
+		assert.Equal(t, string(rune(EMOJI_warning))+"\tmosquitto.service: activating/auto-restart, restarted 2 times", lines[2])
+	})
+	t.Run("v2_uptime_upgraded", func(t *testing.T) {
+		not, err := ParseNotification([]byte(`{"type":"vitals","schema_version":2,"device_mac":"b8:27:eb:a5:be:48","notification":{"online":true,"free_cpu":77,"cpu_uptime":"2 days, 3:10"}}`), "")
+		assert.Nil(t, err)
+		vs := not.Specific().(*vitalStats)
+		assert.Equal(t, 51*time.Hour+10*time.Minute, vs.UpTime.Duration())
+		txt, _ := vs.ToMessageTxt()
+		assert.Contains(t, txt, "Up for: 2d 3h")
+
+		not, err = ParseNotification([]byte(`{"type":"vitals","schema_version":2,"device_mac":"b8:27:eb:a5:be:48","notification":{"cpu_uptime":"garbled"}}`), "")
+		assert.Nil(t, err, "Unparsable uptime is dropped, not rejected")
+		assert.Zero(t, not.Specific().(*vitalStats).UpTime)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		not, err := ParseNotification([]byte(`{"type":"vitals","schema_version":2,"device_mac":"b8:27:eb:a5:be:48","notification":{"services":[{"active_state":"running","restarts":-1}]}}`), "")
+		assert.Nil(t, err)
+		fe, _ := Validate(not, "b8:27:eb:a5:be:48").(FieldErrors)
+		got := []string{}
+		for _, e := range fe {
+			got = append(got, e.Field)
+		}
+		assert.Equal(t, []string{"notification.services[0].name", "notification.services[0].active_state", "notification.services[0].restarts"}, got)
+	})
+	t.Run("constructor", func(t *testing.T) {
+		vs := VitalStats("active\n", "failed\n", "HTTP/1.1 200 OK\r\nServer: gws\r\n", "780 16", " 10:14:52 up 4 days,  8:00,  1 user,  load average: 0.32, 0.28, 0.25").(*vitalStats)
+		assert.Equal(t, "active", vs.Services[0].ActiveState)
+		assert.Equal(t, "failed", vs.Services[1].ActiveState)
+		assert.True(t, vs.Online)
+		assert.Equal(t, 84, vs.FreeCPU)
+		assert.Equal(t, 104*time.Hour, vs.UpTime.Duration())
+
+		vs = Vitals("HTTP/2 200", "780 16", "5 min", nil, UnitStatus("pumpctl.service", "activating\n"), UnitStatus("levelmon.service", "bash: systemctl: command not found"), ServiceStatus("cfgwatch.service", true)).(*vitalStats)
+		assert.Equal(t, []*ServiceUnit{{Name: "pumpctl.service", ActiveState: "activating"}, ServiceStatus("levelmon.service", false), ServiceStatus("cfgwatch.service", true)}, vs.Services, "Units other than aquapone and cfgwatch were expected")
+		assert.True(t, vs.Online)
+
+		vs = VitalStats("", "", "curl: (6) Could not resolve host: www.google.com", "", "").(*vitalStats)
+		assert.Equal(t, "inactive", vs.Services[0].ActiveState)
+		assert.False(t, vs.Online)
+		assert.Equal(t, -1, vs.FreeCPU)
+		assert.Zero(t, vs.UpTime)
+	})
+}
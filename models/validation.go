@@ -0,0 +1,84 @@
+package models
+
+/* Validation of the notifications as the devices send them.
+Each offending field is reported, so that the firmware can be fixed in one go. */
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	macFormat    = regexp.MustCompile(`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`)
+	hhmmFormat   = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+	headerPinMin = 1  // raspberry pi header, pins numbered as on the board
+	headerPinMax = 40 // 40 pin header on all the recent models
+)
+
+// FieldError : a single field of the notification that is not valid
+type FieldError struct {
+	Field string `json:"field"` // path to the field as in the json, ex: notification.all_pins[0].conn_pin
+	Msg   string `json:"msg"`
+}
+
+// FieldErrors : all the offending fields of a notification, nil when valid
+type FieldErrors []FieldError
+
+func (fe FieldErrors) Error() string {
+	bits := make([]string, len(fe))
+	for i, e := range fe {
+		bits[i] = fmt.Sprintf("%s: %s", e.Field, e.Msg)
+	}
+	return fmt.Sprintf("invalid notification, %s", strings.Join(bits, "; "))
+}
+
+/* add : appends the field error, formatted */
+func (fe *FieldErrors) add(field, format string, args ...interface{}) {
+	*fe = append(*fe, FieldError{Field: field, Msg: fmt.Sprintf(format, args...)})
+}
+
+/* errOrNil : nil when there arent any field errors, so that callers can compare it with nil */
+func (fe FieldErrors) errOrNil() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return fe
+}
+
+/*
+	Validate : checks the device details and then the specific notification as per its kind.
+
+devid is the device the notification was posted for, mac of the device in the body has to be the same.
+Error if any is FieldErrors
+*/
+func Validate(not Envelope, devid string) error {
+	fe := FieldErrors{}
+	if dd, ok := not.(*anyNotification); ok {
+		switch {
+		case dd.DeviceMac == "":
+			fe.add("device_mac", "is required")
+		case !macFormat.MatchString(dd.DeviceMac):
+			fe.add("device_mac", "%q is not a mac address, expected format xx:xx:xx:xx:xx:xx", dd.DeviceMac)
+		case !strings.EqualFold(dd.DeviceMac, devid):
+			fe.add("device_mac", "%s does not match the device %s", dd.DeviceMac, devid)
+		}
+		if dd.dateErr != nil {
+			fe = append(fe, *dd.dateErr)
+		}
+	}
+	if k := not.Kind(); k != nil && k.Validate != nil {
+		if err := k.Validate(not.Specific()); err != nil {
+			specific, ok := err.(FieldErrors)
+			if !ok {
+				specific = FieldErrors{{Field: "notification", Msg: err.Error()}}
+			}
+			for _, e := range specific {
+				if !strings.HasPrefix(e.Field, "notification") {
+					e.Field = "notification." + e.Field
+				}
+				fe = append(fe, e)
+			}
+		}
+	}
+	return fe.errOrNil()
+}
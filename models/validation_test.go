@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	devid := "b8:27:eb:a5:be:48"
+	data := []struct {
+		body   string
+		fields []string // offending fields expected, nil when valid
+	}{
+		{body: `{"type":"cfgchange","device_mac":"B8:27:EB:A5:BE:48","notification":{"new":{"config":3,"tickat":"12:00","pulsegap":180,"interval":7200}}}`},
+		{body: `{"type":"cfgchange","device_mac":"b8:27:eb:a5:be:48","notification":{}}`, fields: []string{"notification.new"}},
+		{body: `{"type":"cfgchange","device_mac":"b8:27:eb:a5:be:48","notification":{"new":{"config":1,"tickat":"25:00","pulsegap":-1,"interval":-10}}}`, fields: []string{"notification.new.tickat", "notification.new.interval", "notification.new.pulsegap"}},
+		{body: `{"type":"cfgchange","device_mac":"b8:27:eb:a5:be:48","notification":{"new":{"config":9,"tickat":"12:00"}}}`, fields: []string{"notification.new.config"}},
+		{body: `{"type":"cfgchange","device_mac":"b8:27:eb:a5:be:48","notification":{"new":{"config":1}}}`, fields: []string{"notification.new.tickat"}},
+		{body: `{"type":"gpiostat","device_mac":"b8:27:eb:a5:be:48","notification":{"all_pins":[{"conn_name":"Pump relay-I","conn_type":1,"conn_pin":33,"pin_state":2}]}}`},
+		{body: `{"type":"gpiostat","device_mac":"b8:27:eb:a5:be:48","notification":{"all_pins":[{"conn_name":"Pump relay-I","conn_pin":41,"pin_state":2},{"conn_pin":0,"conn_type":5,"pin_state":9}]}}`, fields: []string{
+			"notification.all_pins[0].conn_pin",
+			"notification.all_pins[1].conn_name",
+			"notification.all_pins[1].conn_pin",
+			"notification.all_pins[1].pin_state",
+			"notification.all_pins[1].conn_type",
+		}},
+		{body: `{"type":"gpiostat","device_mac":"b8:27:eb:a5:be:48","notification":{"all_pins":[
+			{"conn_name":"Soil moisture","conn_pin":72,"pin_state":3,"analog":1.82,"bus":1},
+			{"conn_name":"Tank temp","conn_pin":0,"pin_state":3,"analog":24.5,"bus":3},
+			{"conn_name":"Pump-II","conn_type":1,"conn_pin":12,"pin_state":4,"duty":65}
+		]}}`},
+		{body: `{"type":"gpiostat","device_mac":"b8:27:eb:a5:be:48","notification":{"all_pins":[
+			{"conn_name":"Soil moisture","conn_pin":3,"pin_state":3,"bus":7},
+			{"conn_name":"Pump-II","conn_type":1,"conn_pin":12,"pin_state":4,"duty":120},
+			{"conn_name":"Pump relay-I","conn_type":1,"conn_pin":33,"pin_state":2,"analog":1.2,"duty":50}
+		]}}`, fields: []string{
+			"notification.all_pins[0].bus",
+			"notification.all_pins[0].analog",
+			"notification.all_pins[1].duty",
+			"notification.all_pins[2].analog",
+			"notification.all_pins[2].duty",
+		}},
+		{body: `{"type":"vitals","notification":{}}`, fields: []string{"device_mac"}},
+		{body: `{"type":"vitals","device_mac":"b8-27-eb-a5-be-48","notification":{}}`, fields: []string{"device_mac"}},
+		{body: `{"type":"vitals","device_mac":"b8:27:eb:2c:31:07","notification":{}}`, fields: []string{"device_mac"}},
+	}
+	for _, d := range data {
+		not, err := ParseNotification([]byte(d.body), "")
+		assert.Nil(t, err, "Unexpected error when parsing %s", d.body)
+		err = Validate(not, devid)
+		if d.fields == nil {
+			assert.Nil(t, err, "Unexpected validation error for %s", d.body)
+			continue
+		}
+		fe, ok := err.(FieldErrors)
+		assert.True(t, ok, "Expected field errors for %s", d.body)
+		got := []string{}
+		for _, e := range fe {
+			got = append(got, e.Field)
+		}
+		assert.Equal(t, d.fields, got, "Unexpected offending fields for %s", d.body)
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+/* Schema versions as the devices send them, so that the devices still on older firmware are known.
+This helps plan the firmware rollouts, before the upgrade shims for the older versions can be dropped */
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	/* NewVersionTracker : tracker with nothing seen yet */
+	NewVersionTracker = func() *VersionTracker {
+		return &VersionTracker{seen: map[versionKey]*DeviceVersion{}, latest: map[versionKey]int{}, current: map[string]int{}}
+	}
+)
+
+type versionKey struct {
+	kind    string
+	version int
+	devid   string
+}
+
+// DeviceVersion : a device that sent a version of a kind, and how often
+type DeviceVersion struct {
+	DevID    string    `json:"devid"`
+	Count    int       `json:"count"`     // notifications of the version from the device
+	LastSeen time.Time `json:"last_seen"` // last notification of the version from the device
+}
+
+// VersionUsage : devices sending a schema version of a kind
+type VersionUsage struct {
+	Version int              `json:"version"`
+	Devices []*DeviceVersion `json:"devices"`
+}
+
+// KindVersions : schema versions of a kind in use
+type KindVersions struct {
+	Kind     string          `json:"kind"`
+	Current  int             `json:"current"`  // latest version the server knows of
+	Outdated int             `json:"outdated"` // count of devices that still send older versions, as of their latest notification
+	Versions []*VersionUsage `json:"versions"`
+}
+
+type VersionTracker struct {
+	mu      sync.Mutex
+	seen    map[versionKey]*DeviceVersion
+	latest  map[versionKey]int // kind and device : version of the latest notification from the device
+	current map[string]int     // current version of each kind seen
+}
+
+/* Seen : device sent the notification of the kind and version */
+func (vt *VersionTracker) Seen(devid string, k *Kind, version int) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	vt.current[k.Name] = k.version()
+	key := versionKey{kind: k.Name, version: version, devid: devid}
+	dv, ok := vt.seen[key]
+	if !ok {
+		dv = &DeviceVersion{DevID: devid}
+		vt.seen[key] = dv
+	}
+	dv.Count++
+	dv.LastSeen = time.Now()
+	vt.latest[versionKey{kind: k.Name, devid: devid}] = version
+}
+
+/*
+	Stats : versions in use for each of the kinds, sorted by kind, version and then device.
+
+A device is outdated when its latest notification of the kind is of an older version, devices since upgraded are not.
+When outdatedOnly, only the older versions from the outdated devices are reported
+*/
+func (vt *VersionTracker) Stats(outdatedOnly bool) []*KindVersions {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	byKind := map[string]*KindVersions{}
+	byVersion := map[versionKey]*VersionUsage{}
+	outdated := map[string]map[string]bool{}
+	for key, dv := range vt.seen {
+		kv, ok := byKind[key.kind]
+		if !ok {
+			kv = &KindVersions{Kind: key.kind, Current: vt.current[key.kind], Versions: []*VersionUsage{}}
+			byKind[key.kind] = kv
+			outdated[key.kind] = map[string]bool{}
+		}
+		stillOld := vt.latest[versionKey{kind: key.kind, devid: key.devid}] < kv.Current
+		if stillOld {
+			outdated[key.kind][key.devid] = true
+		}
+		if outdatedOnly && (!stillOld || key.version >= kv.Current) {
+			continue
+		}
+		vkey := versionKey{kind: key.kind, version: key.version}
+		vu, ok := byVersion[vkey]
+		if !ok {
+			vu = &VersionUsage{Version: key.version}
+			byVersion[vkey] = vu
+			kv.Versions = append(kv.Versions, vu)
+		}
+		copied := *dv
+		vu.Devices = append(vu.Devices, &copied)
+	}
+	result := []*KindVersions{}
+	for name, kv := range byKind {
+		kv.Outdated = len(outdated[name])
+		if outdatedOnly && kv.Outdated == 0 {
+			continue
+		}
+		sort.Slice(kv.Versions, func(i, j int) bool { return kv.Versions[i].Version < kv.Versions[j].Version })
+		for _, vu := range kv.Versions {
+			sort.Slice(vu.Devices, func(i, j int) bool { return vu.Devices[i].DevID < vu.Devices[j].DevID })
+		}
+		result = append(result, kv)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Kind < result[j].Kind })
+	return result
+}
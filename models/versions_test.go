@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tankLevel : notification only for the tests, v1 had level in cm, v2 renamed it, v3 has it in mm
+type tankLevel struct {
+	LevelMM int `json:"level_mm"`
+}
+
+func (tl *tankLevel) ToMessageTxt() (string, error) {
+	return fmt.Sprintf("Tank level: %dmm", tl.LevelMM), nil
+}
+
+var tankKind = &Kind{
+	Name:    "tanklevel",
+	New:     func() DeviceNotifcn { return &tankLevel{} },
+	Version: 3,
+	Upgrades: map[int]Upgrade{
+		1: func(old json.RawMessage) (json.RawMessage, error) {
+			v1 := struct {
+				Level int `json:"level"`
+			}{}
+			if err := json.Unmarshal(old, &v1); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string]int{"level_cm": v1.Level})
+		},
+		2: func(old json.RawMessage) (json.RawMessage, error) {
+			v2 := struct {
+				LevelCM int `json:"level_cm"`
+			}{}
+			if err := json.Unmarshal(old, &v2); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string]int{"level_mm": v2.LevelCM * 10})
+		},
+	},
+}
+
+func TestUpgrades(t *testing.T) {
+	data := []struct {
+		body    string
+		sent    int
+		levelMM int
+	}{
+		{body: `{"device_name":"Sump-I","notification":{"level":42}}`, sent: 1, levelMM: 420},
+		{body: `{"device_name":"Sump-I","schema_version":2,"notification":{"level_cm":42}}`, sent: 2, levelMM: 420},
+		{body: `{"device_name":"Sump-I","schema_version":3,"notification":{"level_mm":425}}`, sent: 3, levelMM: 425},
+	}
+	for _, d := range data {
+		not := tankKind.Notification()
+		assert.Nil(t, json.Unmarshal([]byte(d.body), &not), "Unexpected error for %s", d.body)
+		assert.Equal(t, d.sent, not.SentVersion())
+		assert.Equal(t, d.levelMM, not.Specific().(*tankLevel).LevelMM, "Unexpected upgrade of %s", d.body)
+		byt, _ := json.Marshal(not)
+		assert.Contains(t, string(byt), `"schema_version":3`, "Upgraded notification is expected to be of the current version")
+	}
+	broken := &Kind{Name: "broken", New: tankKind.New, Version: 2}
+	not := broken.Notification()
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"notification":{"level":42}}`), &not), ErrUnsupportedVersion, "Missing upgrade was expected to fail")
+}
+
+func TestVersionTracker(t *testing.T) {
+	vt := NewVersionTracker()
+	vt.Seen("b8:27:eb:a5:be:48", tankKind, 1)
+	vt.Seen("b8:27:eb:a5:be:48", tankKind, 1)
+	vt.Seen("b8:27:eb:a5:be:48", tankKind, 3) // firmware upgraded
+	vt.Seen("b8:27:eb:2c:31:07", tankKind, 2)
+	vt.Seen("b8:27:eb:2c:31:07", tankKind, 2)
+	vt.Seen("b8:27:eb:2c:31:07", tankKind, 2)
+
+	stats := vt.Stats(false)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, 3, stats[0].Current)
+	assert.Equal(t, 1, stats[0].Outdated, "Device since upgraded was not expected to be outdated")
+	assert.Len(t, stats[0].Versions, 3)
+	assert.Equal(t, 1, stats[0].Versions[0].Version)
+	assert.Equal(t, 2, stats[0].Versions[0].Devices[0].Count)
+	assert.Equal(t, 3, stats[0].Versions[1].Devices[0].Count)
+
+	stats = vt.Stats(true)
+	assert.Len(t, stats[0].Versions, 1, "Only the versions from devices still outdated were expected")
+	assert.Equal(t, 2, stats[0].Versions[0].Version)
+	assert.Equal(t, "b8:27:eb:2c:31:07", stats[0].Versions[0].Devices[0].DevID)
+
+	vt.Seen("b8:27:eb:2c:31:07", tankKind, 3)
+	assert.Len(t, vt.Stats(true), 0, "No device was expected to be outdated after all upgraded")
+}
@@ -0,0 +1,137 @@
+package models
+
+/* Health of the device as part of the vitals - SoC temperature, memory, disks, load and network.
+All of these are optional, older firmware does not send them. Values over the thresholds are flagged when rendered. */
+import (
+	"fmt"
+)
+
+// VitalThresholds : values over which the vitals are flagged
+type VitalThresholds struct {
+	SoCTemp  float64 // °C
+	MemPct   float64 // memory used %
+	SwapPct  float64 // swap used %
+	DiskPct  float64 // disk used % on any mount
+	Load     float64 // 1 minute load average
+	WifiRSSI int     // dBm, signal weaker than this is flagged
+}
+
+var (
+	/* Thresholds : for all the devices, can be tweaked from the environment at start */
+	Thresholds = VitalThresholds{SoCTemp: 70, MemPct: 90, SwapPct: 50, DiskPct: 90, Load: 4, WifiRSSI: -75}
+)
+
+// Health : health values of the device as part of the vitals, those not known are left nil or empty
+type Health struct {
+	SoCTemp  *float64    `json:"soc_temp,omitempty"`  // SoC temperature in °C
+	Memory   *MemUsage   `json:"memory,omitempty"`    // memory and swap usage
+	Disks    []DiskUsage `json:"disks,omitempty"`     // disk usage per mount
+	Load     *LoadAvg    `json:"load,omitempty"`      // load averages
+	WifiRSSI *int        `json:"wifi_rssi,omitempty"` // WiFi signal strength in dBm
+	IP       string      `json:"ip,omitempty"`        // IP address of the device on the network
+}
+
+/* WithSoCTemp : sets the SoC temperature in °C, as from `vcgencmd measure_temp` */
+func (h *Health) WithSoCTemp(celsius float64) *Health {
+	h.SoCTemp = &celsius
+	return h
+}
+
+/* WithWifiRSSI : sets the WiFi signal strength in dBm */
+func (h *Health) WithWifiRSSI(dbm int) *Health {
+	h.WifiRSSI = &dbm
+	return h
+}
+
+// MemUsage : memory and swap as from `free -m`
+type MemUsage struct {
+	TotalMB     int64 `json:"total_mb"`
+	UsedMB      int64 `json:"used_mb"`
+	SwapTotalMB int64 `json:"swap_total_mb"`
+	SwapUsedMB  int64 `json:"swap_used_mb"`
+}
+
+// DiskUsage : usage of a single mount as from `df -m`
+type DiskUsage struct {
+	Mount   string `json:"mount"`
+	TotalMB int64  `json:"total_mb"`
+	UsedMB  int64  `json:"used_mb"`
+}
+
+// LoadAvg : load averages as from `uptime` or /proc/loadavg
+type LoadAvg struct {
+	One     float64 `json:"1m"`
+	Five    float64 `json:"5m"`
+	Fifteen float64 `json:"15m"`
+}
+
+/* pct : used as a percentage of total, 0 when total is not known */
+func pct(used, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(total)
+}
+
+/* flagged : value marked with the warning when over the threshold */
+func flagged(txt string, over bool) string {
+	if over {
+		return fmt.Sprintf("*%s* %c", txt, EMOJI_warning)
+	}
+	return txt
+}
+
+func (vs *vitalStats) validateHealth(fe *FieldErrors) {
+	if m := vs.Memory; m != nil {
+		if m.TotalMB < 0 || m.UsedMB < 0 || m.UsedMB > m.TotalMB {
+			fe.add("memory.used_mb", "%d is not within 0-%d", m.UsedMB, m.TotalMB)
+		}
+		if m.SwapTotalMB < 0 || m.SwapUsedMB < 0 || m.SwapUsedMB > m.SwapTotalMB {
+			fe.add("memory.swap_used_mb", "%d is not within 0-%d", m.SwapUsedMB, m.SwapTotalMB)
+		}
+	}
+	for i, d := range vs.Disks {
+		if d.Mount == "" {
+			fe.add(fmt.Sprintf("disks[%d].mount", i), "is required")
+		}
+		if d.TotalMB < 0 || d.UsedMB < 0 || d.UsedMB > d.TotalMB {
+			fe.add(fmt.Sprintf("disks[%d].used_mb", i), "%d is not within 0-%d", d.UsedMB, d.TotalMB)
+		}
+	}
+	if l := vs.Load; l != nil && (l.One < 0 || l.Five < 0 || l.Fifteen < 0) {
+		fe.add("load", "cannot be negative")
+	}
+	if vs.WifiRSSI != nil && *vs.WifiRSSI > 0 {
+		fe.add("wifi_rssi", "%d dBm is not a signal strength, expected negative", *vs.WifiRSSI)
+	}
+}
+
+/* toHealthTxt : lines for each of the health values sent, flagged when over the thresholds */
+func (vs *vitalStats) toHealthTxt() string {
+	result := ""
+	if vs.SoCTemp != nil {
+		result = fmt.Sprintf("%s\n%c\tSoC temp: %s", result, EMOJI_thermo, flagged(fmt.Sprintf("%.1f°C", *vs.SoCTemp), *vs.SoCTemp > Thresholds.SoCTemp))
+	}
+	if m := vs.Memory; m != nil {
+		memPct := pct(m.UsedMB, m.TotalMB)
+		result = fmt.Sprintf("%s\n%c\tMemory: %s", result, EMOJI_memory, flagged(fmt.Sprintf("%.0f%% of %dMB", memPct, m.TotalMB), memPct > Thresholds.MemPct))
+		if m.SwapTotalMB > 0 {
+			swapPct := pct(m.SwapUsedMB, m.SwapTotalMB)
+			result = fmt.Sprintf("%s\n%c\tSwap: %s", result, EMOJI_memory, flagged(fmt.Sprintf("%.0f%% of %dMB", swapPct, m.SwapTotalMB), swapPct > Thresholds.SwapPct))
+		}
+	}
+	for _, d := range vs.Disks {
+		diskPct := pct(d.UsedMB, d.TotalMB)
+		result = fmt.Sprintf("%s\n%c\tDisk %s: %s", result, EMOJI_disk, mdEscape(d.Mount), flagged(fmt.Sprintf("%.0f%% of %dMB", diskPct, d.TotalMB), diskPct > Thresholds.DiskPct))
+	}
+	if l := vs.Load; l != nil {
+		result = fmt.Sprintf("%s\n%c\tLoad: %s %.2f %.2f", result, EMOJI_chart, flagged(fmt.Sprintf("%.2f", l.One), l.One > Thresholds.Load), l.Five, l.Fifteen)
+	}
+	if vs.WifiRSSI != nil {
+		result = fmt.Sprintf("%s\n%c\tWiFi: %s", result, EMOJI_signal, flagged(fmt.Sprintf("%d dBm", *vs.WifiRSSI), *vs.WifiRSSI < Thresholds.WifiRSSI))
+	}
+	if vs.IP != "" {
+		result = fmt.Sprintf("%s\n%c\tIP: %s", result, EMOJI_globe, mdEscape(vs.IP))
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVitalsHealth(t *testing.T) {
+	body := `{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{
+		"aquapone_service":true,"cfgwatch_service":true,"online":true,"free_cpu":80,"cpu_uptime":"2 days",
+		"soc_temp":72.4,
+		"memory":{"total_mb":1024,"used_mb":512,"swap_total_mb":100,"swap_used_mb":60},
+		"disks":[{"mount":"/","total_mb":30000,"used_mb":28500},{"mount":"/boot","total_mb":256,"used_mb":50},{"mount":"/mnt/usb_drive","total_mb":1000,"used_mb":100}],
+		"load":{"1m":0.52,"5m":0.4,"15m":0.31},
+		"wifi_rssi":-81,
+		"ip":"192.168.1.21"
+	}}`
+	not, err := ParseNotification([]byte(body), "")
+	assert.Nil(t, err)
+	assert.Nil(t, Validate(not, "b8:27:eb:a5:be:48"))
+	txt, err := not.Specific().ToMessageTxt()
+	assert.Nil(t, err)
+	lines := map[string]string{}
+	for _, l := range strings.Split(txt, "\n") {
+		if bits := strings.SplitN(l, ": ", 2); len(bits) == 2 {
+			lines[strings.TrimSpace(bits[0][strings.Index(bits[0], "\t")+1:])] = bits[1]
+		}
+	}
+	warn := string(rune(EMOJI_warning))
+	data := []struct {
+		line    string
+		val     string
+		flagged bool
+	}{
+		{line: "SoC temp", val: "72.4°C", flagged: true},
+		{line: "Memory", val: "50% of 1024MB"},
+		{line: "Swap", val: "60% of 100MB", flagged: true},
+		{line: "Disk /", val: "95% of 30000MB", flagged: true},
+		{line: "Disk /boot", val: "20% of 256MB"},
+		{line: "Disk /mnt/usb\\_drive", val: "10% of 1000MB"},
+		{line: "Load", val: "0.52 0.40 0.31"},
+		{line: "WiFi", val: "-81 dBm", flagged: true},
+		{line: "IP", val: "192.168.1.21"},
+	}
+	for _, d := range data {
+		got, ok := lines[d.line]
+		assert.True(t, ok, "Expected line for %s in %s", d.line, txt)
+		assert.Contains(t, got, d.val)
+		assert.Equal(t, d.flagged, strings.Contains(got, warn), "Unexpected flag on %s: %s", d.line, got)
+	}
+
+	// same as sent by the firmware in Go
+	byt, _ := json.Marshal(Notification("Sump-I", "b8:27:eb:a5:be:48", time.Now(), Vitals("HTTP/2 200", "780 16", "2 days, 3:10", (&Health{
+		Memory: &MemUsage{TotalMB: 1024, UsedMB: 512},
+		Disks:  []DiskUsage{{Mount: "/mnt/usb_drive", TotalMB: 1000, UsedMB: 950}},
+		IP:     "192.168.1.21",
+	}).WithSoCTemp(52.1).WithWifiRSSI(-60))))
+	not, err = ParseNotification(byt, "")
+	assert.Nil(t, err)
+	assert.Nil(t, Validate(not, "b8:27:eb:a5:be:48"))
+	txt, _ = not.Specific().ToMessageTxt()
+	for _, line := range []string{"SoC temp: 52.1°C", "Memory: 50% of 1024MB", "Disk /mnt/usb\\_drive: *95% of 1000MB*", "WiFi: -60 dBm", "IP: 192.168.1.21"} {
+		assert.Contains(t, txt, line)
+	}
+
+	// older firmware does not send any of these
+	not, err = ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{"online":true,"free_cpu":80}}`), "")
+	assert.Nil(t, err)
+	txt, _ = not.Specific().ToMessageTxt()
+	assert.NotContains(t, txt, "SoC temp")
+	assert.NotContains(t, txt, "Disk")
+
+	not, err = ParseNotification([]byte(`{"type":"vitals","device_mac":"b8:27:eb:a5:be:48","notification":{"free_cpu":120,"memory":{"total_mb":100,"used_mb":200},"disks":[{"total_mb":10,"used_mb":5}],"wifi_rssi":10}}`), "")
+	assert.Nil(t, err)
+	fe, _ := Validate(not, "b8:27:eb:a5:be:48").(FieldErrors)
+	got := []string{}
+	for _, e := range fe {
+		got = append(got, e.Field)
+	}
+	assert.Equal(t, []string{"notification.free_cpu", "notification.memory.used_mb", "notification.disks[0].mount", "notification.wifi_rssi"}, got)
+}
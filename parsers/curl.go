@@ -0,0 +1,32 @@
+package parsers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	HTTPStatus : status code from the output of `curl -I`, any of the HTTP versions
+
+ex: HTTP/2 200, HTTP/1.1 301 Moved Permanently, HTTP/3 200
+Through a proxy or with redirects followed there are more than one responses, the last one is read.
+*/
+func HTTPStatus(out string) (int, error) {
+	status := 0
+	for _, l := range strings.Split(out, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) < 2 || !strings.HasPrefix(strings.ToUpper(fields[0]), "HTTP/") {
+			continue
+		}
+		code, err := strconv.Atoi(fields[1])
+		if err != nil || code < 100 || code > 599 {
+			return 0, fmt.Errorf("curl: bad status line %q", strings.TrimSpace(l))
+		}
+		status = code
+	}
+	if status == 0 {
+		return 0, fmt.Errorf("curl: no status line in output")
+	}
+	return status, nil
+}
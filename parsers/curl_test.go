@@ -0,0 +1,39 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	data := []struct {
+		name string
+		out  string
+		want int
+		err  bool
+	}{
+		{name: "http2", out: "HTTP/2 200 \r\ncontent-type: text/html; charset=ISO-8859-1\r\ndate: Sun, 10 Mar 2024 06:00:00 GMT\r\nserver: gws\r\n\r\n", want: 200},
+		{name: "http11", out: "HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=ISO-8859-1\r\nServer: gws\r\n\r\n", want: 200},
+		{name: "http10", out: "HTTP/1.0 200 OK\r\nServer: BaseHTTP/0.6 Python/3.11\r\n\r\n", want: 200},
+		{name: "http20", out: "HTTP/2.0 200 OK\r\n", want: 200},
+		{name: "http3", out: "HTTP/3 200\r\nalt-svc: h3=\":443\"; ma=2592000\r\n\r\n", want: 200},
+		{name: "redirect", out: "HTTP/1.1 301 Moved Permanently\r\nLocation: http://www.google.com/\r\n\r\n", want: 301},
+		{name: "followed", out: "HTTP/1.1 301 Moved Permanently\r\nLocation: https://www.google.com/\r\n\r\nHTTP/2 200 \r\nserver: gws\r\n\r\n", want: 200},
+		{name: "proxy", out: "HTTP/1.1 200 Connection established\r\n\r\nHTTP/2 204 \r\ncontent-length: 0\r\n\r\n", want: 204},
+		{name: "head_n1", out: "HTTP/2 200", want: 200},
+		{name: "lowercase", out: "http/1.1 503 Service Unavailable", want: 503},
+		{name: "empty", out: "", err: true},
+		{name: "resolve", out: "curl: (6) Could not resolve host: www.google.com", err: true},
+		{name: "bad_code", out: "HTTP/1.1 OK", err: true},
+	}
+	for _, d := range data {
+		got, err := HTTPStatus(d.out)
+		if d.err {
+			assert.NotNil(t, err, "Expected error for %s", d.name)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected error for %s", d.name)
+		assert.Equal(t, d.want, got, "Unexpected status for %s", d.name)
+	}
+}
@@ -0,0 +1,27 @@
+package parsers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// states `systemctl is-active` prints, unknown is for units that are not loaded
+var activeStates = map[string]bool{
+	"active": true, "reloading": true, "inactive": true, "failed": true, "activating": true, "deactivating": true, "maintenance": true, "refreshing": true, "unknown": true,
+}
+
+/*
+	ActiveState : state of the unit from the output of `systemctl is-active <unit>`
+
+When asked for many units, one state per line, or space separated when run through `echo -n $(..)`, the first one is read.
+*/
+func ActiveState(out string) (string, error) {
+	fields := strings.Fields(strings.ToLower(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("systemctl: empty output")
+	}
+	if !activeStates[fields[0]] {
+		return "", fmt.Errorf("systemctl: %q is not an active state", strings.TrimSpace(out))
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,36 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveState(t *testing.T) {
+	data := []struct {
+		out  string
+		want string
+		err  bool
+	}{
+		{out: "active\n", want: "active"},
+		{out: "active", want: "active"},
+		{out: "inactive\n", want: "inactive"},
+		{out: "failed\n", want: "failed"},
+		{out: "activating\n", want: "activating"},
+		{out: "unknown\n", want: "unknown"},
+		{out: "active\nfailed\n", want: "active"},
+		{out: "active failed", want: "active"},
+		{out: "", err: true},
+		{out: "System has not been booted with systemd as init system (PID 1). Can't operate.\nFailed to connect to bus: Host is down", err: true},
+		{out: "bash: systemctl: command not found", err: true},
+	}
+	for _, d := range data {
+		got, err := ActiveState(d.out)
+		if d.err {
+			assert.NotNil(t, err, "Expected error for %q", d.out)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected error for %q", d.out)
+		assert.Equal(t, d.want, got)
+	}
+}
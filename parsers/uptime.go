@@ -0,0 +1,102 @@
+package parsers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	reClock   = regexp.MustCompile(`^(\d+):(\d{2})$`)                      // hours:minutes, ex: 3:10
+	reSpan    = regexp.MustCompile(`(\d+)\s*([a-z]+)`)                     // count and unit, ex: 2 days, 45 min, 4d
+	reProcUp  = regexp.MustCompile(`^(\d+(?:\.\d+)?)(\s+\d+(?:\.\d+)?)?$`) // /proc/uptime, ex: 350735.47 234388.90
+	reBare    = regexp.MustCompile(`^\d+$`)                                // count without the unit, ex: 4 from 45 min cut short
+	spanUnits = map[string]time.Duration{
+		"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+		"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+		"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+		"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+		"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	}
+)
+
+/*
+	Uptime : time since the device booted, from any of the forms below
+
+	`uptime`     10:14:52 up 2 days,  3:10,  1 user,  load average: 0.32, 0.28, 0.25
+	             10:14:52 up 12 days, 45 min,  0 users,  load average: 0.00, 0.01, 0.05
+	             10:14:52 up  1:05,  load average: 0.10, 0.20, 0.30 (busybox)
+	`uptime -p`  up 1 week, 2 days, 3 hours, 10 minutes
+	/proc/uptime 350735.47 234388.90
+
+Also what older firmware cut out of `uptime` with awk, 3 fields and the last character dropped
+ex: "2 days, 3:10", "3:10, 1 user", "5 min, " or "2 days, 4" where the minutes of "2 days, 45 min" are cut short and hence dropped
+*/
+func Uptime(out string) (time.Duration, error) {
+	out = strings.ToLower(strings.TrimSpace(out))
+	if out == "" {
+		return 0, fmt.Errorf("uptime: empty output")
+	}
+	if m := reProcUp.FindStringSubmatch(out); m != nil {
+		secs, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("uptime: %w", err)
+		}
+		return time.Duration(secs * float64(time.Second)).Round(time.Second), nil
+	}
+	if i := strings.Index(out, "up "); i >= 0 {
+		out = out[i+len("up "):]
+	}
+	if i := strings.Index(out, "load average"); i >= 0 {
+		out = out[:i]
+	}
+	var result time.Duration
+	found := false
+	segs := strings.Split(out, ",")
+	for i, seg := range segs {
+		seg = strings.TrimSpace(seg)
+		if seg == "" {
+			continue
+		}
+		if reBare.MatchString(seg) && i == len(segs)-1 && found {
+			break // count without its unit, as cut short by awk on older firmware
+		}
+		if m := reClock.FindStringSubmatch(seg); m != nil {
+			hrs, _ := strconv.Atoi(m[1])
+			mins, _ := strconv.Atoi(m[2])
+			result += time.Duration(hrs)*time.Hour + time.Duration(mins)*time.Minute
+			found = true
+			continue
+		}
+		spans := reSpan.FindAllStringSubmatch(seg, -1)
+		if len(spans) == 0 || strings.Join(strings.Fields(seg), "") != joinSpans(spans) {
+			return 0, fmt.Errorf("uptime: unexpected %q", seg)
+		}
+		if strings.HasPrefix(spans[0][2], "use") {
+			break // count of users logged in, rest of the output is of no interest
+		}
+		for _, s := range spans {
+			unit, ok := spanUnits[s[2]]
+			if !ok {
+				return 0, fmt.Errorf("uptime: unknown unit %q in %q", s[2], seg)
+			}
+			n, _ := strconv.Atoi(s[1])
+			result += time.Duration(n) * unit
+			found = true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("uptime: no duration in %q", out)
+	}
+	return result, nil
+}
+
+func joinSpans(spans [][]string) string {
+	result := ""
+	for _, s := range spans {
+		result += s[1] + s[2]
+	}
+	return result
+}
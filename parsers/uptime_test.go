@@ -0,0 +1,50 @@
+package parsers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUptime(t *testing.T) {
+	day := 24 * time.Hour
+	data := []struct {
+		out  string
+		want time.Duration
+		err  bool
+	}{
+		{out: " 10:14:52 up 2 days,  3:10,  1 user,  load average: 0.32, 0.28, 0.25", want: 2*day + 3*time.Hour + 10*time.Minute},
+		{out: " 10:14:52 up 1 day,  2:03,  2 users,  load average: 0.00, 0.01, 0.05", want: day + 2*time.Hour + 3*time.Minute},
+		{out: " 10:14:52 up 12 days, 45 min,  0 users,  load average: 0.00, 0.01, 0.05", want: 12*day + 45*time.Minute},
+		{out: " 10:14:52 up 5 min,  1 user,  load average: 1.02, 0.56, 0.22", want: 5 * time.Minute},
+		{out: " 10:14:52 up  1:05,  2 users,  load average: 0.10, 0.20, 0.30", want: time.Hour + 5*time.Minute},
+		{out: " 10:14:52 up 2 days,  3:10,  load average: 0.32, 0.28, 0.25", want: 2*day + 3*time.Hour + 10*time.Minute}, // busybox
+		{out: "17:01:44 up 4 days, 16 min,  load average: 0.00, 0.00, 0.00", want: 4*day + 16*time.Minute},               // busybox
+		{out: "up 1 week, 2 days, 3 hours, 10 minutes", want: 9*day + 3*time.Hour + 10*time.Minute},                      // uptime -p
+		{out: "up 3 minutes", want: 3 * time.Minute},                                                                     // uptime -p
+		{out: "350735.47 234388.90\n", want: 350735 * time.Second},                                                       // /proc/uptime
+		{out: "2 days, 3:10", want: 2*day + 3*time.Hour + 10*time.Minute},                                                // awk, older firmware
+		{out: "1 day, 2:03", want: day + 2*time.Hour + 3*time.Minute},                                                    // awk, older firmware
+		{out: "3:10, 1 user", want: 3*time.Hour + 10*time.Minute},                                                        // awk, older firmware
+		{out: "1:05, 2 users", want: time.Hour + 5*time.Minute},                                                          // awk, older firmware
+		{out: "5 min, ", want: 5 * time.Minute},                                                                          // awk, older firmware
+		{out: "2 days, 4", want: 2 * day},                                                                                // awk, older firmware, "2 days, 45 min" cut short
+		{out: "12 days, 4", want: 12 * day},                                                                              // awk, older firmware, "12 days, 45 min" cut short
+		{out: "2 days, 45 min", want: 2*day + 45*time.Minute},
+		{out: "4d 8h", want: 4*day + 8*time.Hour},
+		{out: "", err: true},
+		{out: "up", err: true},
+		{out: "2 fortnights", err: true},
+		{out: "uptime: command not found", err: true},
+	}
+	for _, d := range data {
+		got, err := Uptime(d.out)
+		if d.err {
+			assert.NotNil(t, err, "Expected error for %q", d.out)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected error for %q", d.out)
+		assert.Equal(t, d.want, got, "Unexpected uptime for %q", d.out)
+	}
+}
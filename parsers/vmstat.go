@@ -0,0 +1,121 @@
+package parsers
+
+/* Parsers for the output of the commands the devices run to report their vitals.
+Output of the same command differs across distros and versions, these parse all the forms seen on the field.
+Each parser takes the output as is and is forgiving of the surrounding whitespace. */
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CPU : cpu usage percentages as from vmstat
+type CPU struct {
+	User    int
+	System  int // -1 when not known, as in the reduced form
+	Idle    int // -1 when not known, as in the reduced form
+	Wait    int // -1 when not known
+	Stolen  int // -1 when not known
+	hasIdle bool
+}
+
+/* Free : percentage of cpu that is free, idle when known else whatever isnt used by user and system */
+func (c CPU) Free() int {
+	if c.hasIdle {
+		return c.Idle
+	}
+	free := 100 - c.User
+	if c.System > 0 {
+		free -= c.System
+	}
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+/*
+	Vmstat : cpu usage from the output of vmstat.
+
+Full output with the headers, ex: `vmstat` or `vmstat 1 2`, the last sample is read.
+Also the reduced form the older firmware sends, from `vmstat | awk '{print $12" "$13}' | tail -1`
+Those are the context switches and the user usage ex: "840 14", system usage is then not known
+*/
+func Vmstat(out string) (CPU, error) {
+	lines := []string{}
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 0 {
+		return CPU{}, fmt.Errorf("vmstat: empty output")
+	}
+	cols := map[string]int{}
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		if containsAll(fields, "us", "sy", "id") {
+			for i, f := range fields {
+				cols[f] = i
+			}
+		}
+	}
+	last := strings.Fields(lines[len(lines)-1])
+	if len(cols) == 0 {
+		// reduced form, context switches and user usage
+		if len(last) != 2 {
+			return CPU{}, fmt.Errorf("vmstat: expected context switches and user usage, got %q", lines[len(lines)-1])
+		}
+		_, err1 := strconv.Atoi(last[0])
+		us, err2 := strconv.Atoi(last[1])
+		if err1 != nil || err2 != nil {
+			return CPU{}, fmt.Errorf("vmstat: usage is not numeric %q", lines[len(lines)-1])
+		}
+		if us < 0 || us > 100 {
+			return CPU{}, fmt.Errorf("vmstat: user usage %d is not a percentage", us)
+		}
+		return CPU{User: us, System: -1, Idle: -1, Wait: -1, Stolen: -1}, nil
+	}
+	if _, err := strconv.Atoi(last[0]); err != nil {
+		return CPU{}, fmt.Errorf("vmstat: no samples after the headers")
+	}
+	col := func(name string) (int, error) {
+		i, ok := cols[name]
+		if !ok {
+			return -1, nil
+		}
+		if i >= len(last) {
+			return 0, fmt.Errorf("vmstat: sample is short of column %s", name)
+		}
+		val, err := strconv.Atoi(last[i])
+		if err != nil {
+			return 0, fmt.Errorf("vmstat: column %s is not numeric %q", name, last[i])
+		}
+		return val, nil
+	}
+	result := CPU{hasIdle: true}
+	for _, c := range []struct {
+		name string
+		val  *int
+	}{{"us", &result.User}, {"sy", &result.System}, {"id", &result.Idle}, {"wa", &result.Wait}, {"st", &result.Stolen}} {
+		val, err := col(c.name)
+		if err != nil {
+			return CPU{}, err
+		}
+		*c.val = val
+	}
+	return result, nil
+}
+
+func containsAll(fields []string, want ...string) bool {
+	have := map[string]bool{}
+	for _, f := range fields {
+		have[f] = true
+	}
+	for _, w := range want {
+		if !have[w] {
+			return false
+		}
+	}
+	return true
+}
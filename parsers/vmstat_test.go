@@ -0,0 +1,51 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVmstat(t *testing.T) {
+	data := []struct {
+		name string
+		out  string
+		free int
+		err  bool
+	}{
+		{name: "raspbian_bullseye", out: `procs -----------memory---------- ---swap-- -----io---- -system-- ------cpu-----
+ r  b   swpd   free   buff  cache   si   so    bi    bo   in   cs us sy id wa st
+ 1  0      0 583172  38516 236052    0    0    22     3   67   95  2  1 97  0  0
+`, free: 97},
+		{name: "two_samples", out: `procs -----------memory---------- ---swap-- -----io---- -system-- ------cpu-----
+ r  b   swpd   free   buff  cache   si   so    bi    bo   in   cs us sy id wa st
+ 0  0      0 583172  38516 236052    0    0    22     3   67   95  2  1 97  0  0
+ 2  0      0 583040  38516 236060    0    0     0     0  512  780 16  7 77  0  0
+`, free: 77},
+		{name: "busybox_no_st", out: `procs -----------memory---------- ---swap-- -----io---- -system-- ----cpu----
+ r  b   swpd   free   buff  cache   si   so    bi    bo   in   cs us sy id wa
+ 0  0      0 801152  20648 104480    0    0     5     1   44   60  1  0 99  0
+`, free: 99},
+		{name: "newer_procps_gu", out: `procs -----------memory---------- ---swap-- -----io---- -system-- -------cpu-------
+ r  b   swpd   free   buff  cache   si   so    bi    bo   in   cs us sy id wa st gu
+ 1  0      0 3021444 112340 1204560    0    0    40    12  210  330  3  1 96  0  0  0
+`, free: 96},
+		{name: "reduced", out: "840 14", free: 86},            // older firmware, vmstat | awk '{print $12" "$13}' | tail -1
+		{name: "reduced_idle", out: "95 2", free: 98},         // of raspbian_bullseye above
+		{name: "reduced_newline", out: " 780 16\n", free: 84}, // as through echo -n $(..)
+		{name: "reduced_garbage", out: "cs us", err: true},
+		{name: "reduced_not_pct", out: "16 780", err: true},
+		{name: "reduced_one", out: "16", err: true},
+		{name: "headers_only", out: " r  b   swpd   free   buff  cache   si   so    bi    bo   in   cs us sy id wa st\n", err: true},
+		{name: "empty", out: "", err: true},
+	}
+	for _, d := range data {
+		cpu, err := Vmstat(d.out)
+		if d.err {
+			assert.NotNil(t, err, "Expected error for %s", d.name)
+			continue
+		}
+		assert.Nil(t, err, "Unexpected error for %s", d.name)
+		assert.Equal(t, d.free, cpu.Free(), "Unexpected free cpu for %s", d.name)
+	}
+}
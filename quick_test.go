@@ -54,7 +54,7 @@ func TestApi(t *testing.T) {
 		assert.Nil(t, err, "Unexpected error when forming the request")
 		resp, err := cl.Do(req)
 		assert.Nil(t, err, "unexpected error when executing the request, do you have access to the server ?")
-		assert.Equal(t, resp.StatusCode, http.StatusOK, "Unepxected response code from server")
+		assert.Equal(t, resp.StatusCode, http.StatusAccepted, "Unepxected response code from server")
 	})
 
 	t.Run("GPIO_report_status", func(t *testing.T) {
@@ -68,12 +68,12 @@ func TestApi(t *testing.T) {
 		assert.Nil(t, err, "Unexpected error when forming the request")
 		resp, err := cl.Do(req)
 		assert.Nil(t, err, "unexpected error when executing the request, do you have access to the server ?")
-		assert.Equal(t, resp.StatusCode, http.StatusOK, "Unepxected response code from server")
+		assert.Equal(t, resp.StatusCode, http.StatusAccepted, "Unepxected response code from server")
 	})
 
 	t.Run("vital_status", func(t *testing.T) {
 		url := fmt.Sprintf("%s/?typ=vitals", baseurl)
-		not := models.Notification("Test aquaponics configuration", "b8:27:eb:a5:be:48", time.Now(), models.VitalStats("active", "active", "HTTP/2 200", "16 7", "4d 8h"))
+		not := models.Notification("Test aquaponics configuration", "b8:27:eb:a5:be:48", time.Now(), models.VitalStats("active", "active", "HTTP/2 200", "780 16", "4d 8h"))
 		t.Log("Now logging the vital stats notification")
 		t.Log(not.ToMessageTxt())
 		byt, err := json.Marshal(not)
@@ -83,7 +83,7 @@ func TestApi(t *testing.T) {
 		assert.Nil(t, err, "Unexpected error when forming the request")
 		resp, err := cl.Do(req)
 		assert.Nil(t, err, "unexpected error when executing the request, do you have access to the server ?")
-		assert.Equal(t, resp.StatusCode, http.StatusOK, "Unepxected response code from server")
+		assert.Equal(t, resp.StatusCode, http.StatusAccepted, "Unepxected response code from server")
 	})
 }
 
@@ -0,0 +1,72 @@
+package telegram
+
+/* Minimal client for the telegram bot api, only as much as is needed to post device notifications onto groups.
+https://core.telegram.org/bots/api#sendmessage */
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var (
+	/*
+		NewBot : bot client that can post messages to the telegram server
+		baseurl	: ex: https://api.telegram.org/bot
+		tok		: bot token as issued by the BotFather
+		timeout	: http client timeout for each of the requests */
+	NewBot = func(baseurl, tok string, timeout time.Duration) *Bot {
+		return &Bot{
+			BaseURL: baseurl,
+			Token:   tok,
+			Client:  &http.Client{Timeout: timeout},
+		}
+	}
+)
+
+// BotMessage : payload for sendMessage
+type BotMessage struct {
+	ChatID              string `json:"chat_id"`
+	Txt                 string `json:"text"`
+	ParseMode           string `json:"parse_mode,omitempty"`           // markdown or html - message then can be parse accordigly, plain text when empty
+	DisableNotification bool   `json:"disable_notification,omitempty"` // message is delivered without a sound
+}
+
+type Bot struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+/*
+	SendMessage : posts the message to the chat, any response other than 200 OK is an error.
+
+When telegram responds with an error, the error is *APIError
+*/
+func (b *Bot) SendMessage(bm *BotMessage) error {
+	byt, err := json.Marshal(bm)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bot message %s", err)
+	}
+	url := fmt.Sprintf("%s%s/sendMessage", b.BaseURL, b.Token)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(byt))
+	if err != nil {
+		return fmt.Errorf("failed to form new post request %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification message to telegram server %s", err)
+	}
+	defer resp.Body.Close()
+	byt, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response from telegram server %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseAPIError(resp.StatusCode, byt)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+	APIError : error as reported by the bot api when it responds with ok:false
+
+https://core.telegram.org/bots/api#making-requests
+*/
+type APIError struct {
+	StatusCode  int    `json:"-"`           // http status code of the response
+	Ok          bool   `json:"ok"`          // always false for errors
+	ErrorCode   int    `json:"error_code"`  // mostly the same as http status code
+	Description string `json:"description"` // human readable, ex: Bad Request: chat not found
+	Parameters  struct {
+		RetryAfter      int   `json:"retry_after,omitempty"`        // seconds to wait before the next request, when flood control kicks in
+		MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"` // group was upgraded to a supergroup
+	} `json:"parameters"`
+}
+
+/* parseAPIError : makes the error from the response body, when the body isnt readable the status code alone makes the error */
+func parseAPIError(statusCode int, body []byte) *APIError {
+	ae := &APIError{}
+	if err := json.Unmarshal(body, ae); err != nil || ae.ErrorCode == 0 {
+		ae.ErrorCode = statusCode
+		ae.Description = http.StatusText(statusCode)
+	}
+	ae.StatusCode = statusCode
+	return ae
+}
+
+func (ae *APIError) Error() string {
+	if ae.Parameters.RetryAfter > 0 {
+		return fmt.Sprintf("telegram error %d: %s (retry after %ds)", ae.ErrorCode, ae.Description, ae.Parameters.RetryAfter)
+	}
+	return fmt.Sprintf("telegram error %d: %s", ae.ErrorCode, ae.Description)
+}
+
+/* Retryable : flood control and server side errors can be retried, any other client error (chat not found, bot kicked) would fail again */
+func (ae *APIError) Retryable() bool {
+	return ae.ErrorCode == http.StatusTooManyRequests || ae.ErrorCode >= http.StatusInternalServerError
+}
+
+/* RetryAfter : duration telegram has asked to wait before sending again, zero when not asked */
+func (ae *APIError) RetryAfter() time.Duration {
+	return time.Duration(ae.Parameters.RetryAfter) * time.Second
+}
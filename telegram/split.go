@@ -0,0 +1,67 @@
+package telegram
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxMessageLen = 4096 // telegram rejects text messages longer than this, counted in characters
+)
+
+/*
+	PackMessages : packs the sections into as few messages as possible, each within the limit.
+
+Sections are kept whole as far as possible, those over the limit are split at line breaks
+and lines over the limit are split as is
+*/
+func PackMessages(sections []string, limit int) []string {
+	result := []string{}
+	curr := ""
+	push := func(part, sep string) {
+		if curr == "" {
+			curr = part
+			return
+		}
+		if utf8.RuneCountInString(curr)+utf8.RuneCountInString(sep)+utf8.RuneCountInString(part) > limit {
+			result = append(result, curr)
+			curr = part
+			return
+		}
+		curr = curr + sep + part
+	}
+	for _, sec := range sections {
+		if utf8.RuneCountInString(sec) <= limit {
+			push(sec, "\n\n")
+			continue
+		}
+		for i, line := range strings.Split(sec, "\n") {
+			sep := "\n"
+			if i == 0 {
+				sep = "\n\n"
+			}
+			for _, chunk := range splitRunes(line, limit) {
+				push(chunk, sep)
+				sep = "\n"
+			}
+		}
+	}
+	if curr != "" {
+		result = append(result, curr)
+	}
+	return result
+}
+
+/* splitRunes : splits the string in chunks of limit characters, without breaking any multibyte character */
+func splitRunes(s string, limit int) []string {
+	if utf8.RuneCountInString(s) <= limit {
+		return []string{s}
+	}
+	result := []string{}
+	runes := []rune(s)
+	for len(runes) > limit {
+		result = append(result, string(runes[:limit]))
+		runes = runes[limit:]
+	}
+	return append(result, string(runes))
+}
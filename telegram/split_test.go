@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackMessages(t *testing.T) {
+	t.Run("sections_packed", func(t *testing.T) {
+		msgs := PackMessages([]string{"*Pump-I*\nRelay:\tHIGH", "*Pump-II*\nRelay:\tLOW"}, MaxMessageLen)
+		assert.Equal(t, []string{"*Pump-I*\nRelay:\tHIGH\n\n*Pump-II*\nRelay:\tLOW"}, msgs)
+	})
+	t.Run("sections_kept_whole", func(t *testing.T) {
+		msgs := PackMessages([]string{strings.Repeat("a", 6), strings.Repeat("b", 6)}, 10)
+		assert.Equal(t, []string{"aaaaaa", "bbbbbb"}, msgs, "Sections were not expected to be split")
+	})
+	t.Run("oversize_section", func(t *testing.T) {
+		sec := strings.Repeat("🔼 Relay\n", 1000)
+		msgs := PackMessages([]string{sec}, MaxMessageLen)
+		assert.Greater(t, len(msgs), 1, "Oversize section was expected to be split")
+		for _, m := range msgs {
+			assert.LessOrEqual(t, utf8.RuneCountInString(m), MaxMessageLen)
+			assert.True(t, utf8.ValidString(m))
+		}
+		assert.Equal(t, strings.TrimSuffix(sec, "\n"), strings.TrimSuffix(strings.Join(msgs, "\n"), "\n"), "No content was expected to be lost")
+	})
+	t.Run("oversize_line", func(t *testing.T) {
+		msgs := PackMessages([]string{strings.Repeat("é", 25)}, 10)
+		assert.Equal(t, []string{strings.Repeat("é", 10), strings.Repeat("é", 10), strings.Repeat("é", 5)}, msgs)
+	})
+}